@@ -1,28 +1,792 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
 
+	"github.com/phil-inc/admiral/config"
 	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/phil-inc/admiral/pkg/backend/elasticsearch"
+	"github.com/phil-inc/admiral/pkg/backend/email"
+	"github.com/phil-inc/admiral/pkg/backend/file"
+	"github.com/phil-inc/admiral/pkg/backend/forward"
 	"github.com/phil-inc/admiral/pkg/backend/gchat"
+	"github.com/phil-inc/admiral/pkg/backend/gelf"
+	"github.com/phil-inc/admiral/pkg/backend/grafana"
+	"github.com/phil-inc/admiral/pkg/backend/kafka"
 	"github.com/phil-inc/admiral/pkg/backend/local"
 	"github.com/phil-inc/admiral/pkg/backend/loki"
+	"github.com/phil-inc/admiral/pkg/backend/nats"
+	"github.com/phil-inc/admiral/pkg/backend/opsgenie"
+	"github.com/phil-inc/admiral/pkg/backend/otlp"
+	"github.com/phil-inc/admiral/pkg/backend/pagerduty"
+	"github.com/phil-inc/admiral/pkg/backend/redis"
+	"github.com/phil-inc/admiral/pkg/backend/s3"
+	"github.com/phil-inc/admiral/pkg/backend/slack"
+	"github.com/phil-inc/admiral/pkg/backend/splunk"
+	"github.com/phil-inc/admiral/pkg/backend/syslog"
+	"github.com/phil-inc/admiral/pkg/backend/teams"
+	"github.com/phil-inc/admiral/pkg/backend/webhook"
+	"github.com/phil-inc/admiral/pkg/utils"
 	"github.com/pkg/errors"
 )
 
-func InitBackend(logCh chan backend.RawLog, eventCh chan string, errCh chan error, httpCli *http.Client, bType string, url string) error {
+func InitBackend(logCh chan backend.RawLog, eventCh chan backend.Event, errCh chan error, httpCli *http.Client, cluster string, cfg config.Backend) error {
 	var scopedBackend backend.Backend
 
-	switch bType {
+	switch cfg.Type {
 
 	case "loki":
-		scopedBackend = loki.New().Url(url).LogChannel(logCh).ErrChannel(errCh).Client(httpCli).Build()
+		backendBuilder := loki.New().Url(cfg.URL).StructuredMetadata(cfg.Loki.StructuredMetadata...)
+
+		switch cfg.Loki.Encoding {
+		case "", loki.EncodingJSON, loki.EncodingProtobuf:
+			backendBuilder = backendBuilder.Encoding(cfg.Loki.Encoding)
+		default:
+			return errors.Errorf("invalid encoding in loki backend: %s", cfg.Loki.Encoding)
+		}
+
+		if logCh != nil {
+			backendBuilder = backendBuilder.LogChannel(logCh)
+		}
+
+		if eventCh != nil {
+			backendBuilder = backendBuilder.EventChannel(eventCh)
+		}
+
+		if cfg.Loki.Tenant != "" {
+			tenant, err := parseTemplate("tenant", cfg.Loki.Tenant)
+			if err != nil {
+				return err
+			}
+			backendBuilder = backendBuilder.Tenant(tenant)
+		}
+
+		if cfg.Loki.Username != "" {
+			password, err := cfg.Loki.Password.Get()
+			if err != nil {
+				return errors.Wrap(err, "invalid password in loki backend")
+			}
+			backendBuilder = backendBuilder.BasicAuth(cfg.Loki.Username, password)
+		}
+
+		token, err := cfg.Loki.BearerToken.Get()
+		if err != nil {
+			return errors.Wrap(err, "invalid bearer token in loki backend")
+		}
+		if token != "" {
+			backendBuilder = backendBuilder.BearerToken(token)
+		}
+
+		for _, h := range cfg.Loki.Headers {
+			v, err := h.Get()
+			if err != nil {
+				return errors.Wrapf(err, "invalid header %s in loki backend", h.Name)
+			}
+			backendBuilder = backendBuilder.Header(h.Name, v)
+		}
+
+		for _, r := range cfg.Loki.Relabel {
+			action := r.Action
+			if action == "" {
+				action = loki.ActionReplace
+			}
+
+			switch action {
+			case loki.ActionReplace:
+				if r.TargetLabel == "" {
+					return errors.New("missing targetLabel of replace rule in loki backend")
+				}
+			case loki.ActionKeep, loki.ActionDrop, loki.ActionLabelMap:
+			default:
+				return errors.Errorf("invalid relabel action in loki backend: %s", r.Action)
+			}
+
+			var regex *regexp.Regexp
+			if r.Regex != "" {
+				var err error
+				if regex, err = regexp.Compile("^(?:" + r.Regex + ")$"); err != nil {
+					return errors.Wrap(err, "invalid relabel regex in loki backend")
+				}
+			}
+
+			replacement := loki.DefaultReplacement
+			if r.Replacement != nil {
+				replacement = *r.Replacement
+			}
+
+			backendBuilder = backendBuilder.Relabel(action, r.SourceLabels, r.Separator, regex, r.TargetLabel, replacement)
+		}
+
+		backendBuilder = backendBuilder.AllowLabels(cfg.Loki.AllowLabels...).DenyLabels(cfg.Loki.DenyLabels...)
+
+		scopedBackend = backendBuilder.Batch(cfg.Loki.BatchSize, cfg.Loki.FlushInterval).ErrChannel(errCh).Client(httpCli).Build()
 
 	case "gchat":
-		scopedBackend = gchat.New().Url(url).TextChannel(eventCh).ErrChannel(errCh).Client(httpCli).Build()
+		backendBuilder := gchat.New().Url(cfg.URL).Fields(cfg.GChat.Fields)
+
+		switch cfg.GChat.Format {
+		case "", gchat.FormatText, gchat.FormatCard:
+			backendBuilder = backendBuilder.Format(cfg.GChat.Format)
+		default:
+			return errors.Errorf("invalid format in gchat backend: %s", cfg.GChat.Format)
+		}
+
+		if err := validateFields(cfg.GChat.Fields); err != nil {
+			return err
+		}
+
+		for _, b := range cfg.GChat.Buttons {
+			url, err := parseTemplate(b.Text, b.URL)
+			if err != nil {
+				return err
+			}
+			backendBuilder = backendBuilder.Button(b.Text, url)
+		}
+
+		if cfg.GChat.ThreadKey != "" {
+			threadKey, err := parseTemplate("threadKey", cfg.GChat.ThreadKey)
+			if err != nil {
+				return err
+			}
+			backendBuilder = backendBuilder.ThreadKey(threadKey)
+		}
+
+		scopedBackend = backendBuilder.EventChannel(eventCh).ErrChannel(errCh).Client(httpCli).Build()
+
+	case "slack":
+		if logCh != nil {
+			return errors.New("slack backend only supports events")
+		}
+
+		if err := validateFields(cfg.Slack.Fields); err != nil {
+			return err
+		}
+
+		scopedBackend = slack.New().Url(cfg.URL).Fields(cfg.Slack.Fields).Channel(cfg.Slack.Channel).Username(cfg.Slack.Username).Icon(cfg.Slack.IconEmoji, cfg.Slack.IconURL).EventChannel(eventCh).ErrChannel(errCh).Client(httpCli).Build()
+
+	case "teams":
+		if logCh != nil {
+			return errors.New("teams backend only supports events")
+		}
+
+		if err := validateFields(cfg.Teams.Fields); err != nil {
+			return err
+		}
+
+		scopedBackend = teams.New().Url(cfg.URL).Fields(cfg.Teams.Fields).EventChannel(eventCh).ErrChannel(errCh).Client(httpCli).Build()
+
+	case "pagerduty":
+		if logCh != nil {
+			return errors.New("pagerduty backend only supports events")
+		}
+
+		routingKey, err := cfg.PagerDuty.RoutingKey.Get()
+		if err != nil {
+			return errors.Wrap(err, "invalid routingKey in pagerduty backend")
+		}
+		if routingKey == "" {
+			return errors.New("missing routingKey in pagerduty backend")
+		}
+
+		for eventType, severity := range cfg.PagerDuty.Severities {
+			switch severity {
+			case "critical", "error", "warning", "info", "":
+			default:
+				return errors.Errorf("invalid severity for %s events in pagerduty backend: %s", eventType, severity)
+			}
+		}
+
+		backendBuilder := pagerduty.New().Url(cfg.URL).RoutingKey(routingKey).Severities(cfg.PagerDuty.Severities)
+
+		for _, r := range cfg.PagerDuty.Recoveries {
+			backendBuilder = backendBuilder.Recovery(r.Problem, r.Recovery)
+		}
+
+		scopedBackend = backendBuilder.EventChannel(eventCh).ErrChannel(errCh).Client(httpCli).Build()
+
+	case "opsgenie":
+		if logCh != nil {
+			return errors.New("opsgenie backend only supports events")
+		}
+
+		apiKey, err := cfg.Opsgenie.APIKey.Get()
+		if err != nil {
+			return errors.Wrap(err, "invalid apiKey in opsgenie backend")
+		}
+		if apiKey == "" {
+			return errors.New("missing apiKey in opsgenie backend")
+		}
+
+		backendBuilder := opsgenie.New().Url(cfg.URL).APIKey(apiKey)
+
+		for _, p := range cfg.Opsgenie.Priorities {
+			switch p.Priority {
+			case "P1", "P2", "P3", "P4", "P5":
+				backendBuilder = backendBuilder.Priority(p.Reason, p.Type, p.Priority)
+			default:
+				return errors.Errorf("invalid priority in opsgenie backend: %s", p.Priority)
+			}
+		}
+
+		for _, r := range cfg.Opsgenie.Recoveries {
+			backendBuilder = backendBuilder.Recovery(r.Problem, r.Recovery)
+		}
+
+		scopedBackend = backendBuilder.EventChannel(eventCh).ErrChannel(errCh).Client(httpCli).Build()
+
+	case "grafana-annotations":
+		if logCh != nil {
+			return errors.New("grafana-annotations backend only supports events")
+		}
+
+		if cfg.URL == "" {
+			return errors.New("missing url in grafana-annotations backend")
+		}
+
+		token, err := cfg.Grafana.Token.Get()
+		if err != nil {
+			return errors.Wrap(err, "invalid token in grafana-annotations backend")
+		}
+
+		backendBuilder := grafana.New().Url(cfg.URL).Token(token)
+
+		for _, d := range cfg.Grafana.Dashboards {
+			if d.UID == "" {
+				return errors.New("missing dashboard uid in grafana-annotations backend")
+			}
+			backendBuilder = backendBuilder.Dashboard(d.Namespace, d.Reason, d.Type, d.UID, d.PanelID)
+		}
+
+		scopedBackend = backendBuilder.EventChannel(eventCh).ErrChannel(errCh).Client(httpCli).Build()
+
+	case "email":
+		if logCh != nil {
+			return errors.New("email backend only supports events")
+		}
+
+		u, err := url.Parse(cfg.URL)
+		if err != nil {
+			return errors.Wrap(err, "invalid url in email backend")
+		}
+
+		switch u.Scheme {
+		case email.TransportSMTP, email.TransportSMTPS:
+		default:
+			return errors.Errorf("invalid transport in email backend: %s", u.Scheme)
+		}
+
+		if cfg.Email.From == "" {
+			return errors.New("missing from in email backend")
+		}
+
+		if cfg.Email.To == "" {
+			return errors.New("missing to in email backend")
+		}
+
+		to, err := parseTemplate("to", cfg.Email.To)
+		if err != nil {
+			return err
+		}
+
+		password, err := cfg.Email.Password.Get()
+		if err != nil {
+			return errors.Wrap(err, "invalid password in email backend")
+		}
+
+		tlsConfig, err := newTLSConfig(cfg.Email.TLS.CAFile, cfg.Email.TLS.ServerName, cfg.Email.TLS.InsecureSkipVerify)
+		if err != nil {
+			return err
+		}
+
+		scopedBackend = email.New().Transport(u.Scheme).Address(u.Host).TLSConfig(tlsConfig).Auth(cfg.Email.Username, password).From(cfg.Email.From).To(to).Digest(cfg.Email.Digest).EventChannel(eventCh).ErrChannel(errCh).Build()
+
+	case "webhook":
+		backendBuilder := webhook.New().Url(cfg.URL).Method(cfg.Webhook.Method).ContentType(cfg.Webhook.ContentType)
+
+		switch cfg.Webhook.Method {
+		case "", http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			return errors.Errorf("invalid method in webhook backend: %s", cfg.Webhook.Method)
+		}
+
+		for _, h := range cfg.Webhook.Headers {
+			v, err := h.Get()
+			if err != nil {
+				return errors.Wrapf(err, "invalid header %s in webhook backend", h.Name)
+			}
+			backendBuilder = backendBuilder.Header(h.Name, v)
+		}
+
+		if cfg.Webhook.Body != "" {
+			body, err := parseTemplate("body", cfg.Webhook.Body)
+			if err != nil {
+				return err
+			}
+			backendBuilder = backendBuilder.Body(body)
+		}
+
+		secret, err := cfg.Webhook.Signature.Secret.Get()
+		if err != nil {
+			return errors.Wrap(err, "invalid signature secret in webhook backend")
+		}
+		if secret != "" {
+			backendBuilder = backendBuilder.Signature(cfg.Webhook.Signature.Header, secret)
+		}
+
+		if logCh != nil {
+			backendBuilder = backendBuilder.LogChannel(logCh)
+		}
+
+		if eventCh != nil {
+			backendBuilder = backendBuilder.EventChannel(eventCh)
+		}
+
+		scopedBackend = backendBuilder.ErrChannel(errCh).Client(httpCli).Build()
+
+	case "elasticsearch":
+		es := cfg.Elasticsearch
+		backendBuilder := elasticsearch.New().Url(cfg.URL).Index(es.Index, es.IndexDateFormat).DataStream(es.DataStream).Batch(es.BatchSize, es.BatchBytes, es.FlushInterval)
+
+		password, err := es.Password.Get()
+		if err != nil {
+			return errors.Wrap(err, "invalid password in elasticsearch backend")
+		}
+		if es.Username != "" {
+			backendBuilder = backendBuilder.BasicAuth(es.Username, password)
+		}
+
+		apiKey, err := es.APIKey.Get()
+		if err != nil {
+			return errors.Wrap(err, "invalid apiKey in elasticsearch backend")
+		}
+		if apiKey != "" {
+			backendBuilder = backendBuilder.APIKey(apiKey)
+		}
+
+		if logCh != nil {
+			backendBuilder = backendBuilder.LogChannel(logCh)
+		}
+
+		if eventCh != nil {
+			backendBuilder = backendBuilder.EventChannel(eventCh)
+		}
+
+		scopedBackend = backendBuilder.ErrChannel(errCh).Client(httpCli).Build()
+
+	case "splunk":
+		if eventCh != nil {
+			return errors.New("splunk backend only supports logs")
+		}
+
+		token, err := cfg.Splunk.Token.Get()
+		if err != nil {
+			return errors.Wrap(err, "invalid token in splunk backend")
+		}
+
+		backendBuilder := splunk.New().Url(cfg.URL).Token(token).Batch(cfg.Splunk.BatchSize, cfg.Splunk.FlushInterval).Ack(cfg.Splunk.Ack, cfg.Splunk.AckTimeout)
+
+		if cfg.Splunk.Index != "" {
+			index, err := parseTemplate("index", cfg.Splunk.Index)
+			if err != nil {
+				return err
+			}
+			backendBuilder = backendBuilder.Index(index)
+		}
+
+		if cfg.Splunk.Source != "" {
+			source, err := parseTemplate("source", cfg.Splunk.Source)
+			if err != nil {
+				return err
+			}
+			backendBuilder = backendBuilder.Source(source)
+		}
+
+		if cfg.Splunk.Sourcetype != "" {
+			sourcetype, err := parseTemplate("sourcetype", cfg.Splunk.Sourcetype)
+			if err != nil {
+				return err
+			}
+			backendBuilder = backendBuilder.Sourcetype(sourcetype)
+		}
+
+		scopedBackend = backendBuilder.LogChannel(logCh).ErrChannel(errCh).Client(httpCli).Build()
+
+	case "otlp":
+		backendBuilder := otlp.New().Url(cfg.URL).Cluster(cluster).Batch(cfg.OTLP.BatchSize, cfg.OTLP.FlushInterval)
+
+		switch cfg.OTLP.Encoding {
+		case "", otlp.EncodingProtobuf, otlp.EncodingJSON:
+			backendBuilder = backendBuilder.Encoding(cfg.OTLP.Encoding)
+		default:
+			return errors.Errorf("invalid encoding in otlp backend: %s", cfg.OTLP.Encoding)
+		}
+
+		for _, h := range cfg.OTLP.Headers {
+			v, err := h.Get()
+			if err != nil {
+				return errors.Wrapf(err, "invalid header %s in otlp backend", h.Name)
+			}
+			backendBuilder = backendBuilder.Header(h.Name, v)
+		}
+
+		if logCh != nil {
+			backendBuilder = backendBuilder.LogChannel(logCh)
+		}
+
+		if eventCh != nil {
+			backendBuilder = backendBuilder.EventChannel(eventCh)
+		}
+
+		scopedBackend = backendBuilder.ErrChannel(errCh).Client(httpCli).Build()
+
+	case "syslog":
+		u, err := url.Parse(cfg.URL)
+		if err != nil {
+			return errors.Wrap(err, "invalid url in syslog backend")
+		}
+
+		backendBuilder := syslog.New().Address(u.Host).SDID(cfg.Syslog.SDID)
+
+		switch u.Scheme {
+		case syslog.TransportUDP, syslog.TransportTCP:
+			backendBuilder = backendBuilder.Transport(u.Scheme)
+		case syslog.TransportTLS:
+			tlsConfig, err := newTLSConfig(cfg.Syslog.TLS.CAFile, cfg.Syslog.TLS.ServerName, cfg.Syslog.TLS.InsecureSkipVerify)
+			if err != nil {
+				return err
+			}
+			backendBuilder = backendBuilder.Transport(u.Scheme).TLSConfig(tlsConfig)
+		default:
+			return errors.Errorf("invalid transport in syslog backend: %s", u.Scheme)
+		}
+
+		if cfg.Syslog.Facility != "" {
+			facility, ok := syslog.Facilities[cfg.Syslog.Facility]
+			if !ok {
+				return errors.Errorf("invalid facility in syslog backend: %s", cfg.Syslog.Facility)
+			}
+			backendBuilder = backendBuilder.Facility(facility)
+		}
+
+		if cfg.Syslog.Severity != "" {
+			severity, ok := syslog.Severities[cfg.Syslog.Severity]
+			if !ok {
+				return errors.Errorf("invalid severity in syslog backend: %s", cfg.Syslog.Severity)
+			}
+			backendBuilder = backendBuilder.Severity(severity)
+		}
+
+		if logCh != nil {
+			backendBuilder = backendBuilder.LogChannel(logCh)
+		}
+
+		if eventCh != nil {
+			backendBuilder = backendBuilder.EventChannel(eventCh)
+		}
+
+		scopedBackend = backendBuilder.ErrChannel(errCh).Build()
+
+	case "forward":
+		if eventCh != nil {
+			return errors.New("forward backend only supports logs")
+		}
+
+		u, err := url.Parse(cfg.URL)
+		if err != nil {
+			return errors.Wrap(err, "invalid url in forward backend")
+		}
+
+		backendBuilder := forward.New().Address(u.Host).Batch(cfg.Forward.BatchSize, cfg.Forward.FlushInterval).Ack(cfg.Forward.Ack, cfg.Forward.AckTimeout)
+
+		switch u.Scheme {
+		case "tcp":
+		case "tls":
+			tlsConfig, err := newTLSConfig(cfg.Forward.TLS.CAFile, cfg.Forward.TLS.ServerName, cfg.Forward.TLS.InsecureSkipVerify)
+			if err != nil {
+				return err
+			}
+			backendBuilder = backendBuilder.TLSConfig(tlsConfig)
+		default:
+			return errors.Errorf("invalid transport in forward backend: %s", u.Scheme)
+		}
+
+		if cfg.Forward.Tag != "" {
+			tag, err := parseTemplate("tag", cfg.Forward.Tag)
+			if err != nil {
+				return err
+			}
+			backendBuilder = backendBuilder.Tag(tag)
+		}
+
+		scopedBackend = backendBuilder.LogChannel(logCh).ErrChannel(errCh).Build()
+
+	case "gelf":
+		if eventCh != nil {
+			return errors.New("gelf backend only supports logs")
+		}
+
+		u, err := url.Parse(cfg.URL)
+		if err != nil {
+			return errors.Wrap(err, "invalid url in gelf backend")
+		}
+
+		backendBuilder := gelf.New().Address(u.Host).ChunkSize(cfg.GELF.ChunkSize).Compress(cfg.GELF.Compress)
+
+		switch u.Scheme {
+		case gelf.TransportUDP, gelf.TransportTCP:
+			backendBuilder = backendBuilder.Transport(u.Scheme)
+		case gelf.TransportTLS:
+			tlsConfig, err := newTLSConfig(cfg.GELF.TLS.CAFile, cfg.GELF.TLS.ServerName, cfg.GELF.TLS.InsecureSkipVerify)
+			if err != nil {
+				return err
+			}
+			backendBuilder = backendBuilder.Transport(u.Scheme).TLSConfig(tlsConfig)
+		default:
+			return errors.Errorf("invalid transport in gelf backend: %s", u.Scheme)
+		}
+
+		scopedBackend = backendBuilder.LogChannel(logCh).ErrChannel(errCh).Build()
+
+	case "file":
+		if eventCh != nil {
+			return errors.New("file backend only supports logs")
+		}
+
+		if cfg.File.Path == "" {
+			return errors.New("missing path in file backend")
+		}
+
+		path, err := parseTemplate("path", cfg.File.Path)
+		if err != nil {
+			return err
+		}
+
+		scopedBackend = file.New().Path(path).Rotate(cfg.File.MaxSize, cfg.File.MaxAge).MaxBackups(cfg.File.MaxBackups).Compress(cfg.File.Compress).LogChannel(logCh).ErrChannel(errCh).Build()
+
+	case "s3":
+		if eventCh != nil {
+			return errors.New("s3 backend only supports logs")
+		}
+
+		if cfg.S3.Bucket == "" {
+			return errors.New("missing bucket in s3 backend")
+		}
+
+		accessKeyID, err := cfg.S3.AccessKeyID.Get()
+		if err != nil {
+			return errors.Wrap(err, "invalid accessKeyId in s3 backend")
+		}
+
+		secretAccessKey, err := cfg.S3.SecretAccessKey.Get()
+		if err != nil {
+			return errors.Wrap(err, "invalid secretAccessKey in s3 backend")
+		}
+
+		sessionToken, err := cfg.S3.SessionToken.Get()
+		if err != nil {
+			return errors.Wrap(err, "invalid sessionToken in s3 backend")
+		}
+
+		scopedBackend = s3.New().Url(cfg.URL).Bucket(cfg.S3.Bucket).Region(cfg.S3.Region).Cluster(cluster).Credentials(accessKeyID, secretAccessKey, sessionToken).Flush(cfg.S3.MaxSize, cfg.S3.MaxAge).PartSize(cfg.S3.PartSize).LogChannel(logCh).ErrChannel(errCh).Client(httpCli).Build()
+
+	case "kafka":
+		u, err := url.Parse(cfg.URL)
+		if err != nil {
+			return errors.Wrap(err, "invalid url in kafka backend")
+		}
+
+		if cfg.Kafka.Topic == "" {
+			return errors.New("missing topic in kafka backend")
+		}
+
+		topic, err := parseTemplate("topic", cfg.Kafka.Topic)
+		if err != nil {
+			return err
+		}
+
+		backendBuilder := kafka.New().Brokers(strings.Split(u.Host, ",")).Topic(topic).SchemaID(cfg.Kafka.SchemaID).Batch(cfg.Kafka.BatchSize, cfg.Kafka.FlushInterval)
+
+		switch u.Scheme {
+		case "tcp":
+		case "tls":
+			tlsConfig, err := newTLSConfig(cfg.Kafka.TLS.CAFile, cfg.Kafka.TLS.ServerName, cfg.Kafka.TLS.InsecureSkipVerify)
+			if err != nil {
+				return err
+			}
+			backendBuilder = backendBuilder.TLSConfig(tlsConfig)
+		default:
+			return errors.Errorf("invalid transport in kafka backend: %s", u.Scheme)
+		}
+
+		switch cfg.Kafka.Encoding {
+		case "", kafka.EncodingJSON, kafka.EncodingAvro:
+			backendBuilder = backendBuilder.Encoding(cfg.Kafka.Encoding)
+		default:
+			return errors.Errorf("invalid encoding in kafka backend: %s", cfg.Kafka.Encoding)
+		}
+
+		switch cfg.Kafka.Compression {
+		case "", kafka.CompressionNone, kafka.CompressionGzip, kafka.CompressionSnappy, kafka.CompressionLZ4, kafka.CompressionZstd:
+			backendBuilder = backendBuilder.Compression(cfg.Kafka.Compression)
+		default:
+			return errors.Errorf("invalid compression in kafka backend: %s", cfg.Kafka.Compression)
+		}
+
+		switch cfg.Kafka.Acks {
+		case "", "all":
+			backendBuilder = backendBuilder.Acks(kafka.AcksAll)
+		case "leader":
+			backendBuilder = backendBuilder.Acks(kafka.AcksLeader)
+		case "none":
+			backendBuilder = backendBuilder.Acks(kafka.AcksNone)
+		default:
+			return errors.Errorf("invalid acks in kafka backend: %s", cfg.Kafka.Acks)
+		}
+
+		switch cfg.Kafka.SASL.Mechanism {
+		case "":
+		case kafka.SASLPlain, kafka.SASLScramSHA256, kafka.SASLScramSHA512:
+			password, err := cfg.Kafka.SASL.Password.Get()
+			if err != nil {
+				return errors.Wrap(err, "invalid sasl password in kafka backend")
+			}
+			backendBuilder = backendBuilder.SASL(cfg.Kafka.SASL.Mechanism, cfg.Kafka.SASL.Username, password)
+		default:
+			return errors.Errorf("invalid sasl mechanism in kafka backend: %s", cfg.Kafka.SASL.Mechanism)
+		}
+
+		if logCh != nil {
+			backendBuilder = backendBuilder.LogChannel(logCh)
+		}
+
+		if eventCh != nil {
+			backendBuilder = backendBuilder.EventChannel(eventCh)
+		}
+
+		scopedBackend = backendBuilder.ErrChannel(errCh).Build()
+
+	case "nats":
+		token, err := cfg.NATS.Token.Get()
+		if err != nil {
+			return errors.Wrap(err, "invalid token in nats backend")
+		}
+
+		backendBuilder := nats.New().Url(cfg.URL).Cluster(cluster).Token(token).JetStream(cfg.NATS.JetStream, cfg.NATS.AckTimeout)
+
+		if strings.HasPrefix(cfg.URL, "tls://") {
+			tlsConfig, err := newTLSConfig(cfg.NATS.TLS.CAFile, cfg.NATS.TLS.ServerName, cfg.NATS.TLS.InsecureSkipVerify)
+			if err != nil {
+				return err
+			}
+			backendBuilder = backendBuilder.TLSConfig(tlsConfig)
+		}
+
+		if cfg.NATS.Subject != "" {
+			subject, err := parseTemplate("subject", cfg.NATS.Subject)
+			if err != nil {
+				return err
+			}
+			backendBuilder = backendBuilder.Subject(subject)
+		}
+
+		if logCh != nil {
+			backendBuilder = backendBuilder.LogChannel(logCh)
+		}
+
+		if eventCh != nil {
+			backendBuilder = backendBuilder.EventChannel(eventCh)
+		}
+
+		scopedBackend = backendBuilder.ErrChannel(errCh).Build()
+
+	case "redis":
+		u, err := url.Parse(cfg.URL)
+		if err != nil {
+			return errors.Wrap(err, "invalid url in redis backend")
+		}
+
+		db := 0
+		if path := strings.Trim(u.Path, "/"); path != "" {
+			if db, err = strconv.Atoi(path); err != nil {
+				return errors.Errorf("invalid db in redis backend: %s", path)
+			}
+		}
+
+		// credentials in the config take
+		// precedence over those of the url
+		username := u.User.Username()
+		password, _ := u.User.Password()
+		if cfg.Redis.Username != "" {
+			username = cfg.Redis.Username
+		}
+		if v, err := cfg.Redis.Password.Get(); err != nil {
+			return errors.Wrap(err, "invalid password in redis backend")
+		} else if v != "" {
+			password = v
+		}
+
+		backendBuilder := redis.New().Address(u.Host).DB(db).Auth(username, password).Cluster(cluster)
+
+		switch u.Scheme {
+		case "redis":
+		case "rediss":
+			tlsConfig, err := newTLSConfig(cfg.Redis.TLS.CAFile, cfg.Redis.TLS.ServerName, cfg.Redis.TLS.InsecureSkipVerify)
+			if err != nil {
+				return err
+			}
+			backendBuilder = backendBuilder.TLSConfig(tlsConfig)
+		default:
+			return errors.Errorf("invalid scheme in redis backend: %s", u.Scheme)
+		}
+
+		if cfg.Redis.Key != "" {
+			key, err := parseTemplate("key", cfg.Redis.Key)
+			if err != nil {
+				return err
+			}
+			backendBuilder = backendBuilder.Key(key)
+		}
+
+		if cfg.Redis.MaxLen != 0 {
+			backendBuilder = backendBuilder.MaxLen(cfg.Redis.MaxLen)
+		}
+
+		if logCh != nil {
+			backendBuilder = backendBuilder.LogChannel(logCh)
+		}
+
+		if eventCh != nil {
+			backendBuilder = backendBuilder.EventChannel(eventCh)
+		}
+
+		scopedBackend = backendBuilder.ErrChannel(errCh).Build()
 
 	case "local":
-		backendBuilder := local.New()
+		backendBuilder := local.New().Color(cfg.Local.Color)
+
+		switch cfg.Local.Format {
+		case "", local.FormatText, local.FormatJSON, local.FormatLogfmt:
+			backendBuilder = backendBuilder.Format(cfg.Local.Format)
+		default:
+			return errors.Errorf("invalid format in local backend: %s", cfg.Local.Format)
+		}
+
+		switch cfg.Local.Output {
+		case "", "stdout":
+			backendBuilder = backendBuilder.Output(os.Stdout)
+		case "stderr":
+			backendBuilder = backendBuilder.Output(os.Stderr)
+		default:
+			return errors.Errorf("invalid output in local backend: %s", cfg.Local.Output)
+		}
 
 		if logCh != nil {
 			backendBuilder = backendBuilder.LogChannel(logCh)
@@ -38,7 +802,7 @@ func InitBackend(logCh chan backend.RawLog, eventCh chan string, errCh chan erro
 		break
 
 	default:
-		return errors.Errorf("invalid type in backend: %s", bType)
+		return errors.Errorf("invalid type in backend: %s", cfg.Type)
 	}
 
 	if scopedBackend != nil {
@@ -46,3 +810,48 @@ func InitBackend(logCh chan backend.RawLog, eventCh chan string, errCh chan erro
 	}
 	return nil
 }
+
+// parseTemplate parses a template from the config,
+// wrapping any error with the name of the template.
+func parseTemplate(name string, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(utils.TemplateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid template %q", name)
+	}
+	return t, nil
+}
+
+// validateFields checks that every field
+// is one that events can be laid out by.
+func validateFields(fields []string) error {
+	for _, f := range fields {
+		if _, ok := (backend.Event{}).Field(f); !ok {
+			return errors.Errorf("invalid event field: %s", f)
+		}
+	}
+	return nil
+}
+
+// newTLSConfig returns a TLS client configuration,
+// trusting the CA certificates in caFile if it is set.
+func newTLSConfig(caFile string, serverName string, insecureSkipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
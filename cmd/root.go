@@ -89,7 +89,7 @@ func RootCmd(cmd *cobra.Command, args []string) error {
 	logrus.Println("\tInitializing watchers...")
 
 	rawLogCh := make(chan backend.RawLog)
-	eventCh := make(chan string)
+	eventCh := make(chan backend.Event)
 
 	httpCli := &http.Client{}
 
@@ -104,7 +104,7 @@ func RootCmd(cmd *cobra.Command, args []string) error {
 
 			logrus.Println("\t\tLog informer created")
 
-			err = InitBackend(rawLogCh, nil, errCh, httpCli, w.Backend.Type, w.Backend.URL)
+			err = InitBackend(rawLogCh, nil, errCh, httpCli, cfg.Cluster, w.Backend)
 			if err != nil {
 				return err
 			}
@@ -126,7 +126,7 @@ func RootCmd(cmd *cobra.Command, args []string) error {
 
 			logrus.Println("\t\tEvent informer created")
 
-			err = InitBackend(nil, eventCh, errCh, httpCli, w.Backend.Type, w.Backend.URL)
+			err = InitBackend(nil, eventCh, errCh, httpCli, cfg.Cluster, w.Backend)
 			if err != nil {
 				return err
 			}
@@ -2,7 +2,11 @@ package config
 
 import (
 	"io"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
 
@@ -13,19 +17,276 @@ type Config struct {
 }
 
 type globals struct {
-	Backend backend `yaml:"backend"`
+	Backend Backend `yaml:"backend"`
 }
 
 type watcher struct {
 	Type                      string   `yaml:"type"`
-	Backend                   backend  `yaml:"backend"`
+	Backend                   Backend  `yaml:"backend"`
 	PodFilterAnnotation       string   `yaml:"podFilterAnnotation"`
 	IgnoreContainerAnnotation string   `yaml:"ignoreContainerAnnotation"`
 	Filter                    []string `yaml:"filter"`
 }
 
-type backend struct {
-	Type string `yaml:"type"`
+type Backend struct {
+	Type          string        `yaml:"type"`
+	URL           string        `yaml:"url"`
+	GChat         gchat         `yaml:"gchat"`
+	Slack         slack         `yaml:"slack"`
+	Teams         teams         `yaml:"teams"`
+	PagerDuty     pagerduty     `yaml:"pagerduty"`
+	Opsgenie      opsgenie      `yaml:"opsgenie"`
+	Webhook       webhook       `yaml:"webhook"`
+	Elasticsearch elasticsearch `yaml:"elasticsearch"`
+	Splunk        splunk        `yaml:"splunk"`
+	OTLP          otlp          `yaml:"otlp"`
+	Syslog        syslog        `yaml:"syslog"`
+	Forward       forward       `yaml:"forward"`
+	GELF          gelf          `yaml:"gelf"`
+	File          file          `yaml:"file"`
+	Local         local         `yaml:"local"`
+	S3            s3            `yaml:"s3"`
+	Kafka         kafka         `yaml:"kafka"`
+	NATS          nats          `yaml:"nats"`
+	Redis         redis         `yaml:"redis"`
+	Grafana       grafana       `yaml:"grafana"`
+	Email         email         `yaml:"email"`
+	Loki          loki          `yaml:"loki"`
+}
+
+type gchat struct {
+	Format    string   `yaml:"format"`
+	Fields    []string `yaml:"fields"`
+	Buttons   []button `yaml:"buttons"`
+	ThreadKey string   `yaml:"threadKey"`
+}
+
+type slack struct {
+	Fields    []string `yaml:"fields"`
+	Channel   string   `yaml:"channel"`
+	Username  string   `yaml:"username"`
+	IconEmoji string   `yaml:"iconEmoji"`
+	IconURL   string   `yaml:"iconUrl"`
+}
+
+type teams struct {
+	Fields []string `yaml:"fields"`
+}
+
+type pagerduty struct {
+	RoutingKey value             `yaml:"routingKey"`
+	Severities map[string]string `yaml:"severities"`
+	Recoveries []recovery        `yaml:"recoveries"`
+}
+
+type opsgenie struct {
+	APIKey     value      `yaml:"apiKey"`
+	Priorities []priority `yaml:"priorities"`
+	Recoveries []recovery `yaml:"recoveries"`
+}
+
+type priority struct {
+	Reason   string `yaml:"reason"`
+	Type     string `yaml:"type"`
+	Priority string `yaml:"priority"`
+}
+
+type recovery struct {
+	Problem  string `yaml:"problem"`
+	Recovery string `yaml:"recovery"`
+}
+
+type webhook struct {
+	Method      string    `yaml:"method"`
+	Headers     []header  `yaml:"headers"`
+	Body        string    `yaml:"body"`
+	ContentType string    `yaml:"contentType"`
+	Signature   signature `yaml:"signature"`
+}
+
+type signature struct {
+	Header string `yaml:"header"`
+	Secret value  `yaml:"secret"`
+}
+
+type elasticsearch struct {
+	Index           string        `yaml:"index"`
+	IndexDateFormat string        `yaml:"indexDateFormat"`
+	DataStream      bool          `yaml:"dataStream"`
+	BatchSize       int           `yaml:"batchSize"`
+	BatchBytes      int           `yaml:"batchBytes"`
+	FlushInterval   time.Duration `yaml:"flushInterval"`
+	Username        string        `yaml:"username"`
+	Password        value         `yaml:"password"`
+	APIKey          value         `yaml:"apiKey"`
+}
+
+type splunk struct {
+	Token         value         `yaml:"token"`
+	Index         string        `yaml:"index"`
+	Source        string        `yaml:"source"`
+	Sourcetype    string        `yaml:"sourcetype"`
+	BatchSize     int           `yaml:"batchSize"`
+	FlushInterval time.Duration `yaml:"flushInterval"`
+	Ack           bool          `yaml:"ack"`
+	AckTimeout    time.Duration `yaml:"ackTimeout"`
+}
+
+type otlp struct {
+	Encoding      string        `yaml:"encoding"`
+	Headers       []header      `yaml:"headers"`
+	BatchSize     int           `yaml:"batchSize"`
+	FlushInterval time.Duration `yaml:"flushInterval"`
+}
+
+type syslog struct {
+	Facility string     `yaml:"facility"`
+	Severity string     `yaml:"severity"`
+	SDID     string     `yaml:"sdId"`
+	TLS      tlsOptions `yaml:"tls"`
+}
+
+type forward struct {
+	Tag           string        `yaml:"tag"`
+	BatchSize     int           `yaml:"batchSize"`
+	FlushInterval time.Duration `yaml:"flushInterval"`
+	Ack           bool          `yaml:"ack"`
+	AckTimeout    time.Duration `yaml:"ackTimeout"`
+	TLS           tlsOptions    `yaml:"tls"`
+}
+
+type gelf struct {
+	ChunkSize int        `yaml:"chunkSize"`
+	Compress  bool       `yaml:"compress"`
+	TLS       tlsOptions `yaml:"tls"`
+}
+
+type file struct {
+	Path       string        `yaml:"path"`
+	MaxSize    int64         `yaml:"maxSize"`
+	MaxAge     time.Duration `yaml:"maxAge"`
+	MaxBackups int           `yaml:"maxBackups"`
+	Compress   bool          `yaml:"compress"`
+}
+
+type local struct {
+	Format string `yaml:"format"`
+	Output string `yaml:"output"`
+	Color  bool   `yaml:"color"`
+}
+
+type s3 struct {
+	Bucket          string        `yaml:"bucket"`
+	Region          string        `yaml:"region"`
+	AccessKeyID     value         `yaml:"accessKeyId"`
+	SecretAccessKey value         `yaml:"secretAccessKey"`
+	SessionToken    value         `yaml:"sessionToken"`
+	MaxSize         int           `yaml:"maxSize"`
+	MaxAge          time.Duration `yaml:"maxAge"`
+	PartSize        int           `yaml:"partSize"`
+}
+
+type kafka struct {
+	Topic         string        `yaml:"topic"`
+	Encoding      string        `yaml:"encoding"`
+	SchemaID      int           `yaml:"schemaId"`
+	Compression   string        `yaml:"compression"`
+	Acks          string        `yaml:"acks"`
+	BatchSize     int           `yaml:"batchSize"`
+	FlushInterval time.Duration `yaml:"flushInterval"`
+	SASL          sasl          `yaml:"sasl"`
+	TLS           tlsOptions    `yaml:"tls"`
+}
+
+type sasl struct {
+	Mechanism string `yaml:"mechanism"`
+	Username  string `yaml:"username"`
+	Password  value  `yaml:"password"`
+}
+
+type nats struct {
+	Subject    string        `yaml:"subject"`
+	JetStream  bool          `yaml:"jetStream"`
+	AckTimeout time.Duration `yaml:"ackTimeout"`
+	Token      value         `yaml:"token"`
+	TLS        tlsOptions    `yaml:"tls"`
+}
+
+type redis struct {
+	Key      string     `yaml:"key"`
+	MaxLen   int64      `yaml:"maxLen"`
+	Username string     `yaml:"username"`
+	Password value      `yaml:"password"`
+	TLS      tlsOptions `yaml:"tls"`
+}
+
+type grafana struct {
+	Token      value       `yaml:"token"`
+	Dashboards []dashboard `yaml:"dashboards"`
+}
+
+type dashboard struct {
+	Namespace string `yaml:"namespace"`
+	Reason    string `yaml:"reason"`
+	Type      string `yaml:"type"`
+	UID       string `yaml:"uid"`
+	PanelID   int    `yaml:"panelId"`
+}
+
+type email struct {
+	From     string        `yaml:"from"`
+	To       string        `yaml:"to"`
+	Digest   time.Duration `yaml:"digest"`
+	Username string        `yaml:"username"`
+	Password value         `yaml:"password"`
+	TLS      tlsOptions    `yaml:"tls"`
+}
+
+type loki struct {
+	Encoding           string        `yaml:"encoding"`
+	StructuredMetadata []string      `yaml:"structuredMetadata"`
+	Tenant             string        `yaml:"tenant"`
+	Username           string        `yaml:"username"`
+	Password           value         `yaml:"password"`
+	BearerToken        value         `yaml:"bearerToken"`
+	Headers            []header      `yaml:"headers"`
+	BatchSize          int           `yaml:"batchSize"`
+	FlushInterval      time.Duration `yaml:"flushInterval"`
+	AllowLabels        []string      `yaml:"allowLabels"`
+	DenyLabels         []string      `yaml:"denyLabels"`
+	Relabel            []relabel     `yaml:"relabel"`
+}
+
+type relabel struct {
+	Action       string   `yaml:"action"`
+	SourceLabels []string `yaml:"sourceLabels"`
+	Separator    string   `yaml:"separator"`
+	Regex        string   `yaml:"regex"`
+	TargetLabel  string   `yaml:"targetLabel"`
+	Replacement  *string  `yaml:"replacement"`
+}
+
+type tlsOptions struct {
+	CAFile             string `yaml:"caFile"`
+	ServerName         string `yaml:"serverName"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+}
+
+type header struct {
+	Name  string `yaml:"name"`
+	value `yaml:",inline"`
+}
+
+// value is set either inline, from an
+// environment variable or from a file.
+type value struct {
+	Value    string `yaml:"value"`
+	FromEnv  string `yaml:"fromEnv"`
+	FromFile string `yaml:"fromFile"`
+}
+
+type button struct {
+	Text string `yaml:"text"`
 	URL  string `yaml:"url"`
 }
 
@@ -36,3 +297,27 @@ func (c *Config) Load(file io.Reader) error {
 	}
 	return yaml.Unmarshal(stream, c)
 }
+
+// Get returns the value, reading it from the
+// environment when FromEnv is set, or from the
+// file, without its trailing newline, when
+// FromFile is set.
+func (v value) Get() (string, error) {
+	if v.FromFile != "" {
+		content, err := os.ReadFile(v.FromFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+
+	if v.FromEnv == "" {
+		return v.Value, nil
+	}
+
+	env, ok := os.LookupEnv(v.FromEnv)
+	if !ok {
+		return "", errors.Errorf("environment variable %s is not set", v.FromEnv)
+	}
+	return env, nil
+}
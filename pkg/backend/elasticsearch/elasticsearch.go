@@ -0,0 +1,388 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/phil-inc/admiral/pkg/utils"
+)
+
+const (
+	DefaultIndex         = "admiral"
+	DefaultBatchSize     = 500
+	DefaultBatchBytes    = 5 * 1024 * 1024
+	DefaultFlushInterval = 5 * time.Second
+
+	// maxRetries is how many times items rejected with
+	// a retryable status are resent before being dropped.
+	maxRetries = 3
+)
+
+type Builder struct {
+	url             string
+	client          *http.Client
+	logChannel      chan backend.RawLog
+	eventChannel    chan backend.Event
+	errChannel      chan error
+	index           string
+	indexDateFormat string
+	dataStream      bool
+	batchSize       int
+	batchBytes      int
+	flushInterval   time.Duration
+	authorization   string
+}
+
+// New returns a builder for the elasticsearch struct.
+func New() *Builder {
+	return &Builder{}
+}
+
+// Url sets the Elasticsearch or OpenSearch url.
+func (b *Builder) Url(url string) *Builder {
+	b.url = url
+	return b
+}
+
+// LogChannel sets the channel from where
+// elasticsearch will take logs.
+func (b *Builder) LogChannel(logChannel chan backend.RawLog) *Builder {
+	b.logChannel = logChannel
+	return b
+}
+
+// EventChannel sets the channel from where
+// elasticsearch will take events.
+func (b *Builder) EventChannel(eventChannel chan backend.Event) *Builder {
+	b.eventChannel = eventChannel
+	return b
+}
+
+// ErrChannel sets the channel where
+// elasticsearch will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// Client sets the HTTP client.
+func (b *Builder) Client(client *http.Client) *Builder {
+	b.client = client
+	return b
+}
+
+// Index sets the index, or data stream, documents are
+// written to. With a date format (a Go time layout such
+// as "2006.01.02"), the date of each document is appended.
+func (b *Builder) Index(index string, dateFormat string) *Builder {
+	b.index = index
+	b.indexDateFormat = dateFormat
+	return b
+}
+
+// DataStream writes documents with the create
+// action that data streams require.
+func (b *Builder) DataStream(dataStream bool) *Builder {
+	b.dataStream = dataStream
+	return b
+}
+
+// Batch sets how many documents, or bytes of them, are
+// buffered at most, and how long at most, before a flush.
+func (b *Builder) Batch(size int, bytes int, interval time.Duration) *Builder {
+	b.batchSize = size
+	b.batchBytes = bytes
+	b.flushInterval = interval
+	return b
+}
+
+// BasicAuth authenticates with a username and password.
+func (b *Builder) BasicAuth(username string, password string) *Builder {
+	req := &http.Request{Header: http.Header{}}
+	req.SetBasicAuth(username, password)
+	b.authorization = req.Header.Get("Authorization")
+	return b
+}
+
+// APIKey authenticates with a base64 encoded API key.
+func (b *Builder) APIKey(apiKey string) *Builder {
+	b.authorization = "ApiKey " + apiKey
+	return b
+}
+
+// Build returns a configured elasticsearch struct.
+func (b *Builder) Build() *elasticsearch {
+	e := &elasticsearch{
+		url:             strings.TrimSuffix(b.url, "/") + "/_bulk",
+		client:          b.client,
+		logChannel:      b.logChannel,
+		eventChannel:    b.eventChannel,
+		errChannel:      b.errChannel,
+		index:           b.index,
+		indexDateFormat: b.indexDateFormat,
+		dataStream:      b.dataStream,
+		batchSize:       b.batchSize,
+		batchBytes:      b.batchBytes,
+		flushInterval:   b.flushInterval,
+		authorization:   b.authorization,
+		backoff:         time.Second,
+	}
+
+	if e.index == "" {
+		e.index = DefaultIndex
+	}
+	if e.batchSize <= 0 {
+		e.batchSize = DefaultBatchSize
+	}
+	if e.batchBytes <= 0 {
+		e.batchBytes = DefaultBatchBytes
+	}
+	if e.flushInterval <= 0 {
+		e.flushInterval = DefaultFlushInterval
+	}
+
+	return e
+}
+
+type elasticsearch struct {
+	url             string
+	client          *http.Client
+	logChannel      chan backend.RawLog
+	eventChannel    chan backend.Event
+	errChannel      chan error
+	index           string
+	indexDateFormat string
+	dataStream      bool
+	batchSize       int
+	batchBytes      int
+	flushInterval   time.Duration
+	authorization   string
+	backoff         time.Duration
+}
+
+type document struct {
+	Timestamp time.Time         `json:"@timestamp"`
+	Message   string            `json:"message"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Event     *backend.Event    `json:"event,omitempty"`
+}
+
+// item is one action and document pair of a bulk request.
+type item []byte
+
+type bulkResponse struct {
+	Errors bool                        `json:"errors"`
+	Items  []map[string]bulkItemResult `json:"items"`
+}
+
+type bulkItemResult struct {
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// Stream buffers logs and events into bulk requests,
+// flushing them once a batch limit is reached, at every
+// flush interval, and when the channels are closed.
+func (e *elasticsearch) Stream() {
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+
+	logs, events := e.logChannel, e.eventChannel
+	batch, size := []item{}, 0
+
+	add := func(doc document) {
+		it, err := e.toItem(doc)
+		if err != nil {
+			e.errChannel <- err
+			return
+		}
+
+		batch = append(batch, it)
+		size += len(it)
+
+		if len(batch) >= e.batchSize || size >= e.batchBytes {
+			e.flush(batch)
+			batch, size = []item{}, 0
+		}
+	}
+
+	for logs != nil || events != nil {
+		select {
+		case raw, ok := <-logs:
+			if !ok {
+				logs = nil
+				continue
+			}
+			add(rawLogToDocument(raw))
+
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			add(eventToDocument(event))
+
+		case <-ticker.C:
+			e.flush(batch)
+			batch, size = []item{}, 0
+		}
+	}
+
+	e.flush(batch)
+}
+
+func rawLogToDocument(r backend.RawLog) document {
+	t := time.Now()
+	if ns, err := strconv.ParseInt(r.Timestamp, 10, 64); err == nil {
+		t = time.Unix(0, ns)
+	}
+
+	return document{
+		Timestamp: t,
+		Message:   r.Log,
+		Labels:    r.Metadata,
+	}
+}
+
+func eventToDocument(event backend.Event) document {
+	return document{
+		Timestamp: event.Timestamp,
+		Message:   event.Message,
+		Event:     &event,
+	}
+}
+
+func (e *elasticsearch) toItem(doc document) (item, error) {
+	index := e.index
+	if e.indexDateFormat != "" {
+		index = fmt.Sprintf("%s-%s", index, doc.Timestamp.UTC().Format(e.indexDateFormat))
+	}
+
+	op := "index"
+	if e.dataStream {
+		op = "create"
+	}
+
+	action, err := json.Marshal(map[string]map[string]string{op: {"_index": index}})
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	it := make(item, 0, len(action)+len(source)+2)
+	it = append(it, action...)
+	it = append(it, '\n')
+	it = append(it, source...)
+	it = append(it, '\n')
+	return it, nil
+}
+
+// flush sends the batch, resending only the items
+// rejected with a retryable status until maxRetries.
+func (e *elasticsearch) flush(batch []item) {
+	for attempt := 0; len(batch) > 0; attempt++ {
+		failed, err := e.bulk(batch)
+		if err != nil {
+			e.errChannel <- err
+		}
+
+		if len(failed) == 0 {
+			return
+		}
+
+		if attempt == maxRetries {
+			e.errChannel <- fmt.Errorf("elasticsearch: dropped %d documents after %d retries", len(failed), maxRetries)
+			return
+		}
+
+		time.Sleep(e.backoff * time.Duration(attempt+1))
+		batch = failed
+	}
+}
+
+// bulk sends one bulk request, returning the items that
+// should be retried and an error for those that can't be.
+func (e *elasticsearch) bulk(batch []item) ([]item, error) {
+	var body bytes.Buffer
+	for _, it := range batch {
+		body.Write(it)
+	}
+
+	req, err := http.NewRequest("POST", e.url, &body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if e.authorization != "" {
+		req.Header.Set("Authorization", e.authorization)
+	}
+
+	resBody, err := utils.Do(req, e.client)
+	if err != nil {
+		if httpErr, ok := err.(*utils.HTTPError); ok && retryable(httpErr.StatusCode) {
+			return batch, err
+		}
+		return nil, err
+	}
+
+	res := bulkResponse{}
+	if err := json.Unmarshal(resBody, &res); err != nil {
+		return nil, err
+	}
+
+	if !res.Errors {
+		return nil, nil
+	}
+
+	failed := []item{}
+	rejected := 0
+	var reason json.RawMessage
+
+	for i, result := range res.Items {
+		for _, r := range result {
+			if r.Status < 300 || i >= len(batch) {
+				continue
+			}
+
+			if retryable(r.Status) {
+				failed = append(failed, batch[i])
+				continue
+			}
+
+			rejected++
+			reason = r.Error
+		}
+	}
+
+	if rejected > 0 {
+		return failed, fmt.Errorf("elasticsearch: rejected %d documents: %s", rejected, reason)
+	}
+	return failed, nil
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// Close closes the injected channels. Anything
+// already on the stack will get flushed.
+func (e *elasticsearch) Close() {
+	if e.logChannel != nil {
+		close(e.logChannel)
+	}
+
+	if e.eventChannel != nil {
+		close(e.eventChannel)
+	}
+}
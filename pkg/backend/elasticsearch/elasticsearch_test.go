@@ -0,0 +1,176 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+// bulkServer imitates the _bulk API, rejecting
+// documents whose message is listed in status.
+type bulkServer struct {
+	mutex    sync.Mutex
+	status   map[string]int
+	requests [][]string
+}
+
+func (s *bulkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	messages := []string{}
+	items := []string{}
+	errors := false
+
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		action := map[string]map[string]string{}
+		json.Unmarshal(scanner.Bytes(), &action)
+
+		scanner.Scan()
+		doc := document{}
+		json.Unmarshal(scanner.Bytes(), &doc)
+		messages = append(messages, doc.Message)
+
+		status := http.StatusCreated
+		if s, ok := s.status[doc.Message]; ok {
+			status = s
+			errors = true
+		}
+		// only reject a document the first time
+		delete(s.status, doc.Message)
+
+		for op := range action {
+			items = append(items, fmt.Sprintf(`{%q: {"status": %d, "error": {"type": "error_%d"}}}`, op, status, status))
+		}
+	}
+	s.requests = append(s.requests, messages)
+
+	fmt.Fprintf(w, `{"took": 1, "errors": %t, "items": [%s]}`, errors, strings.Join(items, ","))
+}
+
+func Test_Build(t *testing.T) {
+	cli := &http.Client{}
+	ch := make(chan backend.RawLog)
+
+	e := New().Client(cli).LogChannel(ch).Url("http://opensearch:9200/").APIKey("key").Build()
+
+	assert.NotNil(t, e)
+	assert.Equal(t, "http://opensearch:9200/_bulk", e.url)
+	assert.Equal(t, ch, e.logChannel)
+	assert.Equal(t, "ApiKey key", e.authorization)
+	assert.Equal(t, DefaultIndex, e.index)
+	assert.Equal(t, DefaultBatchSize, e.batchSize)
+	assert.Equal(t, DefaultBatchBytes, e.batchBytes)
+	assert.Equal(t, DefaultFlushInterval, e.flushInterval)
+
+	e = New().BasicAuth("user", "pass").Build()
+	assert.Equal(t, "Basic dXNlcjpwYXNz", e.authorization)
+}
+
+func Test_toItem(t *testing.T) {
+	doc := rawLogToDocument(backend.RawLog{
+		Log:       "some log",
+		Metadata:  map[string]string{"pod": "hello"},
+		Timestamp: "1696118400000000000",
+	})
+
+	e := New().Index("logs", "2006.01.02").Build()
+	it, err := e.toItem(doc)
+	assert.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(it)), "\n")
+	assert.Len(t, lines, 2)
+	assert.JSONEq(t, `{"index": {"_index": "logs-2023.10.01"}}`, lines[0])
+	assert.JSONEq(t, `{"@timestamp": "2023-10-01T00:00:00Z", "message": "some log", "labels": {"pod": "hello"}}`, lines[1])
+
+	e = New().Index("logs-admiral", "").DataStream(true).Build()
+	it, err = e.toItem(doc)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(it), `{"create":{"_index":"logs-admiral"}}`))
+}
+
+func Test_Stream(t *testing.T) {
+	server := &bulkServer{status: map[string]int{
+		"log 1": http.StatusTooManyRequests,
+		"log 2": http.StatusBadRequest,
+	}}
+	ts := httptest.NewServer(server)
+
+	ch := make(chan backend.RawLog, 4)
+	events := make(chan backend.Event, 1)
+	errCh := make(chan error, 4)
+
+	e := New().Client(&http.Client{}).Url(ts.URL).Batch(4, 0, time.Hour).LogChannel(ch).EventChannel(events).ErrChannel(errCh).Build()
+	e.backoff = time.Millisecond
+
+	for i := 0; i < 3; i++ {
+		ch <- backend.RawLog{Log: fmt.Sprintf("log %d", i)}
+	}
+	events <- backend.Event{Message: "some event"}
+	e.Close()
+	e.Stream()
+
+	assert.Len(t, server.requests, 2)
+	assert.ElementsMatch(t, []string{"log 0", "log 1", "log 2", "some event"}, server.requests[0])
+	assert.Equal(t, []string{"log 1"}, server.requests[1])
+
+	assert.Len(t, errCh, 1)
+	assert.Contains(t, (<-errCh).Error(), "rejected 1 documents")
+}
+
+func Test_StreamInterval(t *testing.T) {
+	server := &bulkServer{}
+	ts := httptest.NewServer(server)
+
+	ch := make(chan backend.RawLog)
+	errCh := make(chan error, 1)
+
+	e := New().Client(&http.Client{}).Url(ts.URL).Batch(100, 0, 10*time.Millisecond).LogChannel(ch).ErrChannel(errCh).Build()
+
+	go e.Stream()
+
+	ch <- backend.RawLog{Log: "some log"}
+	time.Sleep(100 * time.Millisecond)
+
+	server.mutex.Lock()
+	assert.Equal(t, [][]string{{"some log"}}, server.requests)
+	server.mutex.Unlock()
+
+	e.Close()
+}
+
+func Test_StreamErr(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, maxRetries+2)
+
+	e := New().Client(&http.Client{}).Url(ts.URL).LogChannel(ch).ErrChannel(errCh).Build()
+	e.backoff = time.Millisecond
+
+	ch <- backend.RawLog{Log: "some log"}
+	e.Close()
+	e.Stream()
+
+	assert.Equal(t, maxRetries+1, attempts)
+	assert.Len(t, errCh, maxRetries+2)
+}
@@ -0,0 +1,431 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+)
+
+const (
+	// TransportSMTP upgrades connections with STARTTLS,
+	// failing when the server does not offer it.
+	TransportSMTP = "smtp"
+	// TransportSMTPS connects with implicit TLS.
+	TransportSMTPS = "smtps"
+
+	dialTimeout = 10 * time.Second
+
+	// maxRetries is how many times an email is sent
+	// again after a transient failure.
+	maxRetries = 3
+)
+
+// errNoStartTLS fails emails rather than sending
+// them, and their password, in plaintext.
+var errNoStartTLS = errors.New("server does not offer STARTTLS")
+
+var textBody = template.Must(template.New("text").Parse(
+	`{{range .}}{{.Timestamp.Format "2006-01-02 15:04:05 MST"}} {{.Type}} {{.Reason}} {{.Namespace}}/{{.Kind}}/{{.Name}}
+{{.Message}}
+
+{{end}}`))
+
+var htmlBody = htmltemplate.Must(htmltemplate.New("html").Parse(`<html>
+<body>
+<table style="border-collapse: collapse; font-family: sans-serif; font-size: 14px">
+<tr style="text-align: left"><th>Time</th><th>Namespace</th><th>Object</th><th>Reason</th><th>Message</th></tr>
+{{range .}}<tr style="border-top: 1px solid #ddd{{if .IsWarning}}; color: #b00020{{end}}">
+<td style="padding: 4px 8px; white-space: nowrap">{{.Timestamp.Format "2006-01-02 15:04:05 MST"}}</td>
+<td style="padding: 4px 8px">{{.Namespace}}</td>
+<td style="padding: 4px 8px">{{.Kind}}/{{.Name}}</td>
+<td style="padding: 4px 8px">{{.Reason}}</td>
+<td style="padding: 4px 8px">{{.Message}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type Builder struct {
+	transport    string
+	address      string
+	tlsConfig    *tls.Config
+	username     string
+	password     string
+	from         string
+	to           *template.Template
+	digest       time.Duration
+	eventChannel chan backend.Event
+	errChannel   chan error
+}
+
+// New returns a builder for the email struct.
+func New() *Builder {
+	return &Builder{}
+}
+
+// Transport sets how the server is connected to:
+// TransportSMTP (default) or TransportSMTPS.
+func (b *Builder) Transport(transport string) *Builder {
+	b.transport = transport
+	return b
+}
+
+// Address sets the host:port of the SMTP server.
+func (b *Builder) Address(address string) *Builder {
+	b.address = address
+	return b
+}
+
+// TLSConfig sets the configuration of
+// STARTTLS and TransportSMTPS.
+func (b *Builder) TLSConfig(tlsConfig *tls.Config) *Builder {
+	b.tlsConfig = tlsConfig
+	return b
+}
+
+// Auth authenticates with PLAIN, which is only
+// allowed over TLS or to localhost.
+func (b *Builder) Auth(username, password string) *Builder {
+	b.username = username
+	b.password = password
+	return b
+}
+
+// From sets the sender of emails.
+func (b *Builder) From(from string) *Builder {
+	b.from = from
+	return b
+}
+
+// To sets the template rendering the comma-separated
+// recipients of an event from its fields.
+func (b *Builder) To(to *template.Template) *Builder {
+	b.to = to
+	return b
+}
+
+// Digest collects the events of each recipient for
+// the window, sending them in a single email. Events
+// are sent one email each without it.
+func (b *Builder) Digest(window time.Duration) *Builder {
+	b.digest = window
+	return b
+}
+
+// EventChannel sets the channel from where
+// email will take events.
+func (b *Builder) EventChannel(eventChannel chan backend.Event) *Builder {
+	b.eventChannel = eventChannel
+	return b
+}
+
+// ErrChannel sets the channel where email
+// will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// Build returns a configured email struct.
+func (b *Builder) Build() *email {
+	transport := b.transport
+	if transport == "" {
+		transport = TransportSMTP
+	}
+
+	host, _, _ := net.SplitHostPort(b.address)
+
+	tlsConfig := b.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+
+	var auth smtp.Auth
+	if b.username != "" {
+		auth = smtp.PlainAuth("", b.username, b.password, host)
+	}
+
+	return &email{
+		transport:    transport,
+		address:      b.address,
+		host:         host,
+		tlsConfig:    tlsConfig,
+		auth:         auth,
+		from:         b.from,
+		to:           b.to,
+		digest:       b.digest,
+		eventChannel: b.eventChannel,
+		errChannel:   b.errChannel,
+		backoff:      time.Second,
+	}
+}
+
+type email struct {
+	transport    string
+	address      string
+	host         string
+	tlsConfig    *tls.Config
+	auth         smtp.Auth
+	from         string
+	to           *template.Template
+	digest       time.Duration
+	eventChannel chan backend.Event
+	errChannel   chan error
+	backoff      time.Duration
+}
+
+// Stream waits to receive something on eventChannel,
+// then emails it to its recipients, or adds it to their
+// digest which is sent at the end of every window.
+func (e *email) Stream() {
+	if e.digest <= 0 {
+		for event := range e.eventChannel {
+			if to, err := e.recipients(event); err != nil {
+				e.errChannel <- err
+			} else {
+				e.send(to, []backend.Event{event})
+			}
+		}
+		return
+	}
+
+	ticker := time.NewTicker(e.digest)
+	defer ticker.Stop()
+
+	// events by their comma-joined recipients
+	digests := map[string][]backend.Event{}
+	flush := func() {
+		for to, events := range digests {
+			e.send(strings.Split(to, ","), events)
+		}
+		digests = map[string][]backend.Event{}
+	}
+
+	for {
+		select {
+		case event, ok := <-e.eventChannel:
+			if !ok {
+				flush()
+				return
+			}
+
+			to, err := e.recipients(event)
+			if err != nil {
+				e.errChannel <- err
+				continue
+			}
+			key := strings.Join(to, ",")
+			digests[key] = append(digests[key], event)
+
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// recipients renders the recipients of the event,
+// sorted so that digests are grouped by the same key.
+func (e *email) recipients(event backend.Event) ([]string, error) {
+	data := event.Fields()
+
+	var buf strings.Builder
+	if err := e.to.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	to := []string{}
+	for _, addr := range strings.Split(buf.String(), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+
+	if len(to) == 0 {
+		return nil, fmt.Errorf("email: no recipients for %v", data)
+	}
+	sort.Strings(to)
+	return to, nil
+}
+
+// send retries the email unless the server
+// rejected it permanently, or lacks STARTTLS.
+func (e *email) send(to []string, events []backend.Event) {
+	msg, err := e.message(to, events)
+	if err != nil {
+		e.errChannel <- err
+		return
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = e.deliver(to, msg)
+
+		var tpErr *textproto.Error
+		if err == nil || attempt == maxRetries || errors.Is(err, errNoStartTLS) || (errors.As(err, &tpErr) && tpErr.Code >= 500) {
+			break
+		}
+		time.Sleep(e.backoff * time.Duration(attempt+1))
+	}
+
+	if err != nil {
+		e.errChannel <- fmt.Errorf("email: dropped %d events to %s: %w", len(events), strings.Join(to, ","), err)
+	}
+}
+
+func (e *email) deliver(to []string, msg []byte) error {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	var conn net.Conn
+	var err error
+	if e.transport == TransportSMTPS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", e.address, e.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", e.address)
+	}
+	if err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if e.transport == TransportSMTP {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errNoStartTLS
+		}
+		if err := c.StartTLS(e.tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if e.auth != nil {
+		if err := c.Auth(e.auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(e.from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// message lays the events out as a
+// multipart/alternative email.
+func (e *email) message(to []string, events []backend.Event) ([]byte, error) {
+	var text, html bytes.Buffer
+	if err := textBody.Execute(&text, events); err != nil {
+		return nil, err
+	}
+	if err := htmlBody.Execute(&html, events); err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write(part.content); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject(events)))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@admiral>\r\n", hex.EncodeToString(id))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+func subject(events []backend.Event) string {
+	if len(events) == 1 {
+		e := events[0]
+		return fmt.Sprintf("[%s] %s %s/%s", e.Cluster, e.Reason, strings.ToLower(e.Kind), e.Name)
+	}
+
+	warnings := 0
+	for _, e := range events {
+		if e.IsWarning() {
+			warnings++
+		}
+	}
+	return fmt.Sprintf("[%s] %d events, %d warnings", events[0].Cluster, len(events), warnings)
+}
+
+// Close closes the eventChannel. Anything already
+// on the stack, or in a digest, will get sent.
+func (e *email) Close() {
+	close(e.eventChannel)
+}
@@ -0,0 +1,394 @@
+package email
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+var mocked_event = backend.Event{
+	Cluster:   "hello-cluster",
+	Namespace: "payments",
+	Kind:      "Pod",
+	Name:      "hello-pod",
+	Reason:    "BackOff",
+	Type:      "Warning",
+	Message:   "Back-off restarting <failed> container",
+	Timestamp: time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC),
+}
+
+var recipients = template.Must(template.New("to").Parse(
+	`ops@example.com{{if eq .namespace "payments"}}, payments@example.com{{end}}`))
+
+// received is an email as received by the server.
+type received struct {
+	from   string
+	to     []string
+	data   []byte
+	secure bool
+}
+
+// mailbox is the backend of an in-process SMTP server, which
+// authenticates admiral with its password, rejects unknown
+// recipients and fails the first failures emails with a
+// transient error.
+type mailbox struct {
+	password string
+	failures int
+
+	mutex sync.Mutex
+	mails []received
+}
+
+func (b *mailbox) NewSession(c *smtp.Conn) (smtp.Session, error) {
+	_, secure := c.TLSConnectionState()
+	return &session{mailbox: b, m: received{secure: secure}}, nil
+}
+
+func (b *mailbox) received() []received {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]received{}, b.mails...)
+}
+
+type session struct {
+	mailbox       *mailbox
+	authenticated bool
+	m             received
+}
+
+func (s *session) AuthMechanisms() []string {
+	return []string{sasl.Plain}
+}
+
+func (s *session) Auth(mech string) (sasl.Server, error) {
+	return sasl.NewPlainServer(func(identity, username, password string) error {
+		if username != "admiral" || password != s.mailbox.password {
+			return &smtp.SMTPError{Code: 535, EnhancedCode: smtp.EnhancedCode{5, 7, 8}, Message: "Authentication credentials invalid"}
+		}
+		s.authenticated = true
+		return nil
+	}), nil
+}
+
+func (s *session) Mail(from string, opts *smtp.MailOptions) error {
+	if !s.authenticated {
+		return smtp.ErrAuthRequired
+	}
+	s.m.from = from
+	return nil
+}
+
+func (s *session) Rcpt(to string, opts *smtp.RcptOptions) error {
+	if strings.Contains(to, "unknown") {
+		return &smtp.SMTPError{Code: 550, EnhancedCode: smtp.EnhancedCode{5, 1, 1}, Message: "No such user"}
+	}
+	s.m.to = append(s.m.to, to)
+	return nil
+}
+
+func (s *session) Data(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mailbox.mutex.Lock()
+	defer s.mailbox.mutex.Unlock()
+
+	if s.mailbox.failures > 0 {
+		s.mailbox.failures--
+		return &smtp.SMTPError{Code: 451, EnhancedCode: smtp.EnhancedCode{4, 3, 0}, Message: "Try again later"}
+	}
+
+	s.m.data = data
+	s.mailbox.mails = append(s.mailbox.mails, s.m)
+	return nil
+}
+
+func (s *session) Reset() {
+	s.m = received{secure: s.m.secure}
+}
+
+func (s *session) Logout() error {
+	return nil
+}
+
+// certificate returns a self-signed certificate
+// for 127.0.0.1, and the pool trusting it.
+func certificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// serve runs the SMTP server on a random port
+// until the test ends, returning its address.
+func serve(t *testing.T, server *smtp.Server, listener net.Listener) string {
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String()
+}
+
+// parse returns the subject, and the
+// text and html parts of the email.
+func parse(t *testing.T, data []byte) (string, string, string) {
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	assert.Nil(t, err)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	assert.Nil(t, err)
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.Nil(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	parts := map[string]string{}
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+
+		b, err := io.ReadAll(p)
+		assert.Nil(t, err)
+		parts[p.Header.Get("Content-Type")] = string(b)
+	}
+
+	return subject, parts["text/plain; charset=utf-8"], parts["text/html; charset=utf-8"]
+}
+
+func newEmail(address string, pool *x509.CertPool, ch chan backend.Event, errCh chan error) *Builder {
+	return New().Address(address).TLSConfig(&tls.Config{RootCAs: pool}).Auth("admiral", "secret").From("admiral@example.com").To(recipients).EventChannel(ch).ErrChannel(errCh)
+}
+
+func Test_Build(t *testing.T) {
+	ch := make(chan backend.Event)
+	errCh := make(chan error)
+
+	e := New().Address("smtp.example.com:587").Auth("admiral", "secret").From("admiral@example.com").To(recipients).Digest(time.Hour).EventChannel(ch).ErrChannel(errCh).Build()
+
+	assert.Equal(t, TransportSMTP, e.transport)
+	assert.Equal(t, "smtp.example.com:587", e.address)
+	assert.Equal(t, "smtp.example.com", e.tlsConfig.ServerName)
+	assert.NotNil(t, e.auth)
+	assert.Equal(t, "admiral@example.com", e.from)
+	assert.Equal(t, recipients, e.to)
+	assert.Equal(t, time.Hour, e.digest)
+	assert.Equal(t, ch, e.eventChannel)
+	assert.Equal(t, errCh, e.errChannel)
+}
+
+func Test_recipients(t *testing.T) {
+	e := New().To(recipients).Build()
+
+	to, err := e.recipients(mocked_event)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ops@example.com", "payments@example.com"}, to)
+
+	event := mocked_event
+	event.Namespace = "default"
+	to, err = e.recipients(event)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ops@example.com"}, to)
+
+	e = New().To(template.Must(template.New("to").Parse(`{{if eq .namespace "payments"}}payments@example.com{{end}}`))).Build()
+	_, err = e.recipients(event)
+	assert.Contains(t, err.Error(), "email: no recipients for")
+}
+
+func Test_Stream(t *testing.T) {
+	cert, pool := certificate(t)
+	b := &mailbox{password: "secret"}
+
+	server := smtp.NewServer(b)
+	server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := serve(t, server, listener)
+
+	ch := make(chan backend.Event, 2)
+	errCh := make(chan error, 1)
+
+	e := newEmail(address, pool, ch, errCh).Build()
+
+	other := mocked_event
+	other.Namespace = "default"
+	other.Type = "Normal"
+	other.Reason = "Pulled"
+
+	ch <- mocked_event
+	ch <- other
+	e.Close()
+	e.Stream()
+
+	assert.Empty(t, errCh)
+
+	mails := b.received()
+	assert.Len(t, mails, 2)
+
+	assert.True(t, mails[0].secure)
+	assert.Equal(t, "admiral@example.com", mails[0].from)
+	assert.Equal(t, []string{"ops@example.com", "payments@example.com"}, mails[0].to)
+
+	subject, text, html := parse(t, mails[0].data)
+	assert.Equal(t, "[hello-cluster] BackOff pod/hello-pod", subject)
+	assert.Equal(t, "2023-10-01 00:00:00 UTC Warning BackOff payments/Pod/hello-pod\r\nBack-off restarting <failed> container\r\n\r\n", text)
+	assert.Contains(t, html, "color: #b00020")
+	assert.Contains(t, html, "Back-off restarting &lt;failed&gt; container")
+
+	assert.Equal(t, []string{"ops@example.com"}, mails[1].to)
+	subject, _, html = parse(t, mails[1].data)
+	assert.Equal(t, "[hello-cluster] Pulled pod/hello-pod", subject)
+	assert.NotContains(t, html, "color: #b00020")
+}
+
+func Test_StreamDigest(t *testing.T) {
+	cert, pool := certificate(t)
+	b := &mailbox{password: "secret"}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	assert.Nil(t, err)
+	address := serve(t, smtp.NewServer(b), listener)
+
+	ch := make(chan backend.Event, 3)
+	errCh := make(chan error, 1)
+
+	e := newEmail(address, pool, ch, errCh).Transport(TransportSMTPS).Digest(time.Hour).Build()
+
+	normal := mocked_event
+	normal.Type = "Normal"
+	normal.Reason = "Started"
+	other := normal
+	other.Namespace = "default"
+
+	ch <- mocked_event
+	ch <- normal
+	ch <- other
+	e.Close()
+	e.Stream()
+
+	assert.Empty(t, errCh)
+
+	mails := b.received()
+	assert.Len(t, mails, 2)
+
+	for _, m := range mails {
+		assert.True(t, m.secure)
+		subject, text, _ := parse(t, m.data)
+
+		if len(m.to) == 2 {
+			assert.Equal(t, "[hello-cluster] 2 events, 1 warnings", subject)
+			assert.Contains(t, text, "Warning BackOff payments/Pod/hello-pod")
+			assert.Contains(t, text, "Normal Started payments/Pod/hello-pod")
+		} else {
+			assert.Equal(t, []string{"ops@example.com"}, m.to)
+			assert.Equal(t, "[hello-cluster] Started pod/hello-pod", subject)
+		}
+	}
+}
+
+func Test_StreamErr(t *testing.T) {
+	cert, pool := certificate(t)
+	b := &mailbox{password: "secret", failures: 1}
+
+	server := smtp.NewServer(b)
+	server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := serve(t, server, listener)
+
+	ch := make(chan backend.Event, 2)
+	errCh := make(chan error, 1)
+
+	e := newEmail(address, pool, ch, errCh).Build()
+	e.backoff = 0
+
+	unknown := mocked_event
+	unknown.Namespace = "unknown"
+	e.to = template.Must(template.New("to").Parse(`{{.namespace}}@example.com`))
+
+	// the first is retried after a transient
+	// error, the second rejected for good
+	ch <- mocked_event
+	ch <- unknown
+	e.Close()
+	e.Stream()
+
+	err = <-errCh
+	assert.Equal(t, "email: dropped 1 events to unknown@example.com: 550 \"5.1.1 No such user\"", err.Error())
+	assert.Len(t, b.received(), 1)
+
+	// with the wrong password
+	ch = make(chan backend.Event, 1)
+	e = newEmail(address, pool, ch, errCh).Auth("admiral", "invalid").Build()
+
+	ch <- mocked_event
+	e.Close()
+	e.Stream()
+
+	err = <-errCh
+	assert.Contains(t, err.Error(), "535 \"5.7.8 Authentication credentials invalid\"")
+}
+
+func Test_StreamPlaintext(t *testing.T) {
+	_, pool := certificate(t)
+	b := &mailbox{password: "secret"}
+
+	// without a TLSConfig the server offers no STARTTLS
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := serve(t, smtp.NewServer(b), listener)
+
+	ch := make(chan backend.Event, 1)
+	errCh := make(chan error, 1)
+
+	e := newEmail(address, pool, ch, errCh).Build()
+
+	ch <- mocked_event
+	e.Close()
+	e.Stream()
+
+	err = <-errCh
+	assert.Equal(t, "email: dropped 1 events to ops@example.com,payments@example.com: server does not offer STARTTLS", err.Error())
+	assert.Empty(t, b.received())
+}
@@ -0,0 +1,78 @@
+package backend
+
+import (
+	"fmt"
+	"time"
+)
+
+type Event struct {
+	Cluster   string            `json:"cluster"`
+	Namespace string            `json:"namespace"`
+	Kind      string            `json:"kind"`
+	Name      string            `json:"name"`
+	Reason    string            `json:"reason"`
+	Type      string            `json:"type"`
+	Message   string            `json:"message"`
+	Labels    map[string]string `json:"labels"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// String formats the event as a human-readable message.
+func (e Event) String() string {
+	return fmt.Sprintf(`
+cluster:   %s
+namespace: %s
+object:    %s
+reason:    %s
+message:   %s
+timestamp: %s`,
+		e.Cluster, e.Namespace, e.Name, e.Reason, e.Message, e.Timestamp)
+}
+
+// DefaultFields are the event fields shown by
+// chat backends when none are configured.
+var DefaultFields = []string{"namespace", "object", "message"}
+
+// FieldNames are the names of all the event fields.
+var FieldNames = []string{"cluster", "namespace", "kind", "object", "reason", "type", "message", "timestamp"}
+
+// Field returns the value of a named event field
+// as it is laid out by the chat backends
+// and rendered by templates.
+func (e Event) Field(name string) (string, bool) {
+	switch name {
+	case "cluster":
+		return e.Cluster, true
+	case "namespace":
+		return e.Namespace, true
+	case "kind":
+		return e.Kind, true
+	case "object":
+		return e.Name, true
+	case "reason":
+		return e.Reason, true
+	case "type":
+		return e.Type, true
+	case "message":
+		return e.Message, true
+	case "timestamp":
+		return e.Timestamp.Format(time.RFC3339), true
+	}
+	return "", false
+}
+
+// Fields returns the event fields by name, which
+// is the data templates rendered from events get.
+func (e Event) Fields() map[string]string {
+	fields := map[string]string{}
+	for _, name := range FieldNames {
+		fields[name], _ = e.Field(name)
+	}
+	return fields
+}
+
+// IsWarning reports whether the event
+// is of the Kubernetes Warning type.
+func (e Event) IsWarning() bool {
+	return e.Type == "Warning"
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package file
+
+import (
+	"os"
+	"time"
+)
+
+// created returns when the file was last modified,
+// as its creation time isn't portably available.
+func created(f *os.File, info os.FileInfo) time.Time {
+	return info.ModTime()
+}
@@ -0,0 +1,359 @@
+package file
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+)
+
+const (
+	// idleTimeout is how long a file is kept
+	// open after the last record written to it.
+	idleTimeout = 5 * time.Minute
+
+	backupTimeFormat = "20060102T150405.000"
+)
+
+type Builder struct {
+	path       *template.Template
+	logChannel chan backend.RawLog
+	errChannel chan error
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	compress   bool
+}
+
+// New returns a builder for the file struct.
+func New() *Builder {
+	return &Builder{}
+}
+
+// Path sets the template rendering the
+// path of a log's file from its labels.
+func (b *Builder) Path(path *template.Template) *Builder {
+	b.path = path
+	return b
+}
+
+// LogChannel sets the channel from where
+// file will take logs.
+func (b *Builder) LogChannel(logChannel chan backend.RawLog) *Builder {
+	b.logChannel = logChannel
+	return b
+}
+
+// ErrChannel sets the channel where file
+// will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// Rotate sets the size in bytes and the age after which
+// a file is rotated. Zero disables either limit.
+func (b *Builder) Rotate(maxSize int64, maxAge time.Duration) *Builder {
+	b.maxSize = maxSize
+	b.maxAge = maxAge
+	return b
+}
+
+// MaxBackups sets how many rotated files are kept
+// per path. Zero keeps all of them.
+func (b *Builder) MaxBackups(maxBackups int) *Builder {
+	b.maxBackups = maxBackups
+	return b
+}
+
+// Compress gzips the rotated files.
+func (b *Builder) Compress(compress bool) *Builder {
+	b.compress = compress
+	return b
+}
+
+// Build returns a configured file struct.
+func (b *Builder) Build() *file {
+	return &file{
+		path:          b.path,
+		logChannel:    b.logChannel,
+		errChannel:    b.errChannel,
+		maxSize:       b.maxSize,
+		maxAge:        b.maxAge,
+		maxBackups:    b.maxBackups,
+		compress:      b.compress,
+		checkInterval: time.Minute,
+		files:         map[string]*openFile{},
+	}
+}
+
+type file struct {
+	path          *template.Template
+	logChannel    chan backend.RawLog
+	errChannel    chan error
+	maxSize       int64
+	maxAge        time.Duration
+	maxBackups    int
+	compress      bool
+	checkInterval time.Duration
+	files         map[string]*openFile
+}
+
+type openFile struct {
+	f       *os.File
+	size    int64
+	created time.Time
+	written time.Time
+}
+
+type record struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Log       string            `json:"log"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// Stream appends whatever is received on logChannel
+// to its file, rotating files which are too large
+// or too old, until logChannel is closed.
+func (f *file) Stream() {
+	ticker := time.NewTicker(f.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case raw, ok := <-f.logChannel:
+			if !ok {
+				f.closeFiles()
+				return
+			}
+
+			if err := f.write(raw); err != nil {
+				f.errChannel <- err
+			}
+
+		case <-ticker.C:
+			f.check()
+		}
+	}
+}
+
+func (f *file) write(r backend.RawLog) error {
+	var path strings.Builder
+	if err := f.path.Execute(&path, r.Metadata); err != nil {
+		return err
+	}
+
+	t := time.Now()
+	if ns, err := strconv.ParseInt(r.Timestamp, 10, 64); err == nil {
+		t = time.Unix(0, ns)
+	}
+
+	line, err := json.Marshal(record{Timestamp: t, Log: r.Log, Labels: r.Metadata})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	name := filepath.Clean(path.String())
+
+	of, ok := f.files[name]
+	if ok && f.maxSize > 0 && of.size > 0 && of.size+int64(len(line)) > f.maxSize {
+		if err := f.rotate(name); err != nil {
+			return err
+		}
+		ok = false
+	}
+
+	if !ok {
+		if of, err = open(name); err != nil {
+			return err
+		}
+		f.files[name] = of
+	}
+
+	n, err := of.f.Write(line)
+	of.size += int64(n)
+	of.written = time.Now()
+	return err
+}
+
+func open(name string) (*openFile, error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// the age of a file reopened after being idle,
+	// or by a restart, counts from its creation
+	now := time.Now()
+	createdAt := now
+	if info.Size() > 0 {
+		createdAt = created(f, info)
+	}
+
+	return &openFile{f: f, size: info.Size(), created: createdAt, written: now}, nil
+}
+
+// check rotates the files older than maxAge,
+// and closes the ones no longer written to.
+func (f *file) check() {
+	for name, of := range f.files {
+		if f.maxAge > 0 && of.size > 0 && time.Since(of.created) >= f.maxAge {
+			if err := f.rotate(name); err != nil {
+				f.errChannel <- err
+			}
+			continue
+		}
+
+		if time.Since(of.written) >= idleTimeout {
+			of.f.Close()
+			delete(f.files, name)
+		}
+	}
+}
+
+// rotate closes the file and renames it with a timestamp,
+// compressing it if enabled, and removes the oldest
+// rotated files past maxBackups.
+func (f *file) rotate(name string) error {
+	of := f.files[name]
+	delete(f.files, name)
+
+	if err := of.f.Close(); err != nil {
+		return err
+	}
+
+	backup := backupName(name, time.Now())
+	if err := os.Rename(name, backup); err != nil {
+		return err
+	}
+
+	if f.compress {
+		if err := compress(backup); err != nil {
+			return err
+		}
+	}
+
+	return f.prune(name)
+}
+
+// backupName returns the name of a file rotated at t,
+// later if another rotation already took that name.
+func backupName(name string, t time.Time) string {
+	ext := filepath.Ext(name)
+
+	for {
+		backup := strings.TrimSuffix(name, ext) + "-" + t.Format(backupTimeFormat) + ext
+		if _, err := os.Stat(backup); os.IsNotExist(err) {
+			if _, err := os.Stat(backup + ".gz"); os.IsNotExist(err) {
+				return backup
+			}
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+func compress(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	w := gzip.NewWriter(dst)
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(name)
+}
+
+// prune removes the oldest rotated files of name,
+// which sort by their timestamp, past maxBackups.
+func (f *file) prune(name string) error {
+	if f.maxBackups <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(name))
+	if err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(name)
+	prefix := strings.TrimSuffix(filepath.Base(name), ext) + "-"
+
+	backups := []string{}
+	for _, e := range entries {
+		if isBackup(e.Name(), prefix, ext) {
+			backups = append(backups, filepath.Join(filepath.Dir(name), e.Name()))
+		}
+	}
+	sort.Strings(backups)
+
+	for len(backups) > f.maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// isBackup reports whether the file is a rotated one, so
+// that the file of pod "api" doesn't match "api-worker".
+func isBackup(name, prefix, ext string) bool {
+	if !strings.HasPrefix(name, prefix) || len(name) < len(prefix)+len(backupTimeFormat) {
+		return false
+	}
+
+	timestamp := name[len(prefix) : len(prefix)+len(backupTimeFormat)]
+	if _, err := time.Parse(backupTimeFormat, timestamp); err != nil {
+		return false
+	}
+
+	rest := name[len(prefix)+len(backupTimeFormat):]
+	return rest == ext || rest == ext+".gz"
+}
+
+func (f *file) closeFiles() {
+	for name, of := range f.files {
+		if err := of.f.Close(); err != nil {
+			f.errChannel <- err
+		}
+		delete(f.files, name)
+	}
+}
+
+// Close closes the logChannel. Anything already
+// on the stack will get written.
+func (f *file) Close() {
+	close(f.logChannel)
+}
@@ -0,0 +1,193 @@
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+func pathTemplate(dir string) *template.Template {
+	return template.Must(template.New("path").Parse(dir + "/{{.namespace}}/{{.pod}}.log"))
+}
+
+func readRecords(t *testing.T, name string) []record {
+	f, err := os.Open(name)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(f)
+		assert.Nil(t, err)
+		r = gz
+	}
+
+	records := []record{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		rec := record{}
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &rec))
+		records = append(records, rec)
+	}
+	return records
+}
+
+func Test_Build(t *testing.T) {
+	ch := make(chan backend.RawLog)
+	errCh := make(chan error)
+	path := pathTemplate("/data")
+
+	f := New().Path(path).LogChannel(ch).ErrChannel(errCh).Rotate(1024, time.Hour).MaxBackups(3).Compress(true).Build()
+
+	assert.Equal(t, path, f.path)
+	assert.Equal(t, ch, f.logChannel)
+	assert.Equal(t, errCh, f.errChannel)
+	assert.Equal(t, int64(1024), f.maxSize)
+	assert.Equal(t, time.Hour, f.maxAge)
+	assert.Equal(t, 3, f.maxBackups)
+	assert.True(t, f.compress)
+}
+
+func Test_Stream(t *testing.T) {
+	dir := t.TempDir()
+
+	ch := make(chan backend.RawLog, 3)
+	errCh := make(chan error, 1)
+
+	f := New().Path(pathTemplate(dir)).LogChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- backend.RawLog{Log: "first", Timestamp: "1696118400123456789", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	ch <- backend.RawLog{Log: "second", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	ch <- backend.RawLog{Log: "other", Metadata: map[string]string{"namespace": "hello", "pod": "world-2"}}
+	f.Close()
+	f.Stream()
+
+	records := readRecords(t, filepath.Join(dir, "hello", "world.log"))
+	assert.Len(t, records, 2)
+	assert.Equal(t, "first", records[0].Log)
+	assert.Equal(t, time.Unix(0, 1696118400123456789), records[0].Timestamp.Local())
+	assert.Equal(t, map[string]string{"namespace": "hello", "pod": "world"}, records[0].Labels)
+	assert.Equal(t, "second", records[1].Log)
+
+	records = readRecords(t, filepath.Join(dir, "hello", "world-2.log"))
+	assert.Len(t, records, 1)
+	assert.Equal(t, "other", records[0].Log)
+
+	assert.Empty(t, f.files)
+	assert.Empty(t, errCh)
+}
+
+func Test_RotateSize(t *testing.T) {
+	dir := t.TempDir()
+
+	ch := make(chan backend.RawLog, 10)
+	errCh := make(chan error, 1)
+
+	// every record fills a file
+	f := New().Path(pathTemplate(dir)).Rotate(1, 0).MaxBackups(2).Compress(true).LogChannel(ch).ErrChannel(errCh).Build()
+
+	for _, log := range []string{"1", "2", "3", "4", "5"} {
+		ch <- backend.RawLog{Log: log, Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	}
+	// a pod whose name starts like the other's
+	ch <- backend.RawLog{Log: "other", Metadata: map[string]string{"namespace": "hello", "pod": "world-2"}}
+	f.Close()
+	f.Stream()
+
+	backups, err := filepath.Glob(filepath.Join(dir, "hello", "world-*.log.gz"))
+	assert.Nil(t, err)
+	assert.Len(t, backups, 2)
+	assert.Equal(t, "3", readRecords(t, backups[0])[0].Log)
+	assert.Equal(t, "4", readRecords(t, backups[1])[0].Log)
+
+	assert.Equal(t, "5", readRecords(t, filepath.Join(dir, "hello", "world.log"))[0].Log)
+	assert.Equal(t, "other", readRecords(t, filepath.Join(dir, "hello", "world-2.log"))[0].Log)
+	assert.Empty(t, errCh)
+}
+
+func Test_RotateAge(t *testing.T) {
+	dir := t.TempDir()
+	errCh := make(chan error, 1)
+
+	f := New().Path(pathTemplate(dir)).Rotate(0, 10*time.Millisecond).ErrChannel(errCh).Build()
+
+	assert.Nil(t, f.write(backend.RawLog{Log: "first", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}))
+
+	f.check()
+	assert.Len(t, f.files, 1)
+
+	time.Sleep(20 * time.Millisecond)
+	f.check()
+	assert.Empty(t, f.files)
+
+	backups, err := filepath.Glob(filepath.Join(dir, "hello", "world-*.log"))
+	assert.Nil(t, err)
+	assert.Len(t, backups, 1)
+	assert.Equal(t, "first", readRecords(t, backups[0])[0].Log)
+	assert.Empty(t, errCh)
+}
+
+func Test_RotateAgeReopened(t *testing.T) {
+	dir := t.TempDir()
+	errCh := make(chan error, 1)
+
+	f := New().Path(pathTemplate(dir)).Rotate(0, 300*time.Millisecond).ErrChannel(errCh).Build()
+	labels := map[string]string{"namespace": "hello", "pod": "world"}
+
+	assert.Nil(t, f.write(backend.RawLog{Log: "first", Metadata: labels}))
+	time.Sleep(200 * time.Millisecond)
+
+	// closed for being idle, then reopened
+	f.files[filepath.Join(dir, "hello", "world.log")].written = time.Now().Add(-idleTimeout)
+	f.check()
+	assert.Empty(t, f.files)
+
+	assert.Nil(t, f.write(backend.RawLog{Log: "second", Metadata: labels}))
+	time.Sleep(150 * time.Millisecond)
+
+	// old enough since the file was created,
+	// although not since it was reopened
+	f.check()
+	assert.Empty(t, f.files)
+
+	backups, err := filepath.Glob(filepath.Join(dir, "hello", "world-*.log"))
+	assert.Nil(t, err)
+	assert.Len(t, backups, 1)
+	assert.Len(t, readRecords(t, backups[0]), 2)
+	assert.Empty(t, errCh)
+}
+
+func Test_isBackup(t *testing.T) {
+	assert.True(t, isBackup("world-20231001T000000.000.log", "world-", ".log"))
+	assert.True(t, isBackup("world-20231001T000000.000.log.gz", "world-", ".log"))
+	assert.False(t, isBackup("world.log", "world-", ".log"))
+	assert.False(t, isBackup("world-2.log", "world-", ".log"))
+	assert.False(t, isBackup("world-2-20231001T000000.000.log", "world-", ".log"))
+	assert.False(t, isBackup("world-20231001T000000.000.json", "world-", ".log"))
+}
+
+func Test_StreamErr(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "hello"), nil, 0644))
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	f := New().Path(pathTemplate(dir)).LogChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- backend.RawLog{Log: "some log", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	f.Close()
+	f.Stream()
+
+	assert.NotNil(t, <-errCh)
+}
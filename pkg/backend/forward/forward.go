@@ -0,0 +1,381 @@
+package forward
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+)
+
+const (
+	DefaultTag           = "{{.namespace}}.{{.container}}"
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = 5 * time.Second
+	DefaultAckTimeout    = 30 * time.Second
+
+	dialTimeout = 10 * time.Second
+
+	// maxRetries is how many times a chunk that
+	// couldn't be written or acked is resent.
+	maxRetries = 3
+)
+
+type Builder struct {
+	address       string
+	tlsConfig     *tls.Config
+	logChannel    chan backend.RawLog
+	errChannel    chan error
+	tag           *template.Template
+	batchSize     int
+	flushInterval time.Duration
+	ack           bool
+	ackTimeout    time.Duration
+}
+
+// New returns a builder for the forward struct.
+func New() *Builder {
+	return &Builder{}
+}
+
+// Address sets the host:port of the
+// Fluentd or Fluent Bit aggregator.
+func (b *Builder) Address(address string) *Builder {
+	b.address = address
+	return b
+}
+
+// TLSConfig enables TLS on the connection.
+func (b *Builder) TLSConfig(tlsConfig *tls.Config) *Builder {
+	b.tlsConfig = tlsConfig
+	return b
+}
+
+// LogChannel sets the channel from where
+// forward will take logs.
+func (b *Builder) LogChannel(logChannel chan backend.RawLog) *Builder {
+	b.logChannel = logChannel
+	return b
+}
+
+// ErrChannel sets the channel where forward
+// will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// Tag sets the template rendering the
+// tag of a log from its labels.
+func (b *Builder) Tag(tag *template.Template) *Builder {
+	b.tag = tag
+	return b
+}
+
+// Batch sets how many logs are buffered
+// at most, and how long, before a flush.
+func (b *Builder) Batch(size int, interval time.Duration) *Builder {
+	b.batchSize = size
+	b.flushInterval = interval
+	return b
+}
+
+// Ack waits for the aggregator to acknowledge each
+// chunk, resending it if it doesn't within timeout.
+func (b *Builder) Ack(ack bool, timeout time.Duration) *Builder {
+	b.ack = ack
+	b.ackTimeout = timeout
+	return b
+}
+
+// Build returns a configured forward struct.
+func (b *Builder) Build() *forward {
+	f := &forward{
+		address:       b.address,
+		tlsConfig:     b.tlsConfig,
+		logChannel:    b.logChannel,
+		errChannel:    b.errChannel,
+		tag:           b.tag,
+		batchSize:     b.batchSize,
+		flushInterval: b.flushInterval,
+		ack:           b.ack,
+		ackTimeout:    b.ackTimeout,
+	}
+
+	if f.tag == nil {
+		f.tag = template.Must(template.New("tag").Option("missingkey=zero").Parse(DefaultTag))
+	}
+	if f.batchSize <= 0 {
+		f.batchSize = DefaultBatchSize
+	}
+	if f.flushInterval <= 0 {
+		f.flushInterval = DefaultFlushInterval
+	}
+	if f.ackTimeout <= 0 {
+		f.ackTimeout = DefaultAckTimeout
+	}
+
+	return f
+}
+
+type forward struct {
+	address       string
+	tlsConfig     *tls.Config
+	logChannel    chan backend.RawLog
+	errChannel    chan error
+	tag           *template.Template
+	batchSize     int
+	flushInterval time.Duration
+	ack           bool
+	ackTimeout    time.Duration
+	conn          net.Conn
+	reader        *bufio.Reader
+	mutex         sync.Mutex
+}
+
+// chunk holds the encoded entries of one tag,
+// sent together in PackedForward mode.
+type chunk struct {
+	entries []byte
+	size    int
+}
+
+// Stream buffers logs into chunks per tag, flushing
+// them once the batch is full, at every flush interval,
+// and when logChannel is closed.
+func (f *forward) Stream() {
+	ticker := time.NewTicker(f.flushInterval)
+	defer ticker.Stop()
+
+	batch := map[string]*chunk{}
+	size := 0
+
+	for {
+		select {
+		case raw, ok := <-f.logChannel:
+			if !ok {
+				f.flush(batch)
+				return
+			}
+
+			tag, err := f.renderTag(raw.Metadata)
+			if err != nil {
+				f.errChannel <- err
+				continue
+			}
+
+			c, ok := batch[tag]
+			if !ok {
+				c = &chunk{}
+				batch[tag] = c
+			}
+			c.entries = appendEntry(c.entries, raw)
+			c.size++
+
+			size++
+			if size >= f.batchSize {
+				f.flush(batch)
+				batch = map[string]*chunk{}
+				size = 0
+			}
+
+		case <-ticker.C:
+			f.flush(batch)
+			batch = map[string]*chunk{}
+			size = 0
+		}
+	}
+}
+
+func (f *forward) renderTag(labels map[string]string) (string, error) {
+	var buf strings.Builder
+	if err := f.tag.Execute(&buf, labels); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// appendEntry encodes the log as a [time, record]
+// entry, with its labels as fields of the record.
+func appendEntry(b []byte, r backend.RawLog) []byte {
+	t := time.Now()
+	if ns, err := strconv.ParseInt(r.Timestamp, 10, 64); err == nil {
+		t = time.Unix(0, ns)
+	}
+
+	b = appendArrayHeader(b, 2)
+	b = appendEventTime(b, t)
+
+	fields := 1
+	for k := range r.Metadata {
+		if k != "log" {
+			fields++
+		}
+	}
+
+	b = appendMapHeader(b, fields)
+	b = appendString(b, "log")
+	b = appendString(b, r.Log)
+	for k, v := range r.Metadata {
+		if k != "log" {
+			b = appendString(b, k)
+			b = appendString(b, v)
+		}
+	}
+
+	return b
+}
+
+func (f *forward) flush(batch map[string]*chunk) {
+	for tag, c := range batch {
+		if err := f.send(tag, c); err != nil {
+			f.errChannel <- err
+		}
+	}
+}
+
+// send writes the chunk as a PackedForward message,
+// reconnecting and resending it if the write fails,
+// or, with acks enabled, if it isn't acknowledged.
+func (f *forward) send(tag string, c *chunk) error {
+	var id string
+	if f.ack {
+		var err error
+		if id, err = chunkID(); err != nil {
+			return err
+		}
+	}
+
+	msg := appendArrayHeader(nil, 3)
+	msg = appendString(msg, tag)
+	msg = appendBin(msg, c.entries)
+	if f.ack {
+		msg = appendMapHeader(msg, 2)
+		msg = appendString(msg, "chunk")
+		msg = appendString(msg, id)
+	} else {
+		msg = appendMapHeader(msg, 1)
+	}
+	msg = appendString(msg, "size")
+	msg = appendUint(msg, uint64(c.size))
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if f.conn == nil {
+			if err = f.dial(); err != nil {
+				continue
+			}
+		}
+
+		if err = f.write(msg, id); err == nil {
+			return nil
+		}
+
+		f.conn.Close()
+		f.conn = nil
+	}
+
+	return fmt.Errorf("forward: dropped %d logs tagged %s: %w", c.size, tag, err)
+}
+
+func (f *forward) write(msg []byte, id string) error {
+	if _, err := f.conn.Write(msg); err != nil {
+		return err
+	}
+
+	if !f.ack {
+		return nil
+	}
+
+	f.conn.SetReadDeadline(time.Now().Add(f.ackTimeout))
+	defer f.conn.SetReadDeadline(time.Time{})
+
+	ack, err := readAck(f.reader)
+	if err != nil {
+		return err
+	}
+	if ack != id {
+		return fmt.Errorf("forward: got ack %s for chunk %s", ack, id)
+	}
+	return nil
+}
+
+// readAck reads the {"ack": <chunk>} response.
+func readAck(r *bufio.Reader) (string, error) {
+	n, err := readMapHeader(r)
+	if err != nil {
+		return "", err
+	}
+
+	ack := ""
+	for i := 0; i < n; i++ {
+		k, err := readString(r)
+		if err != nil {
+			return "", err
+		}
+
+		v, err := readString(r)
+		if err != nil {
+			return "", err
+		}
+
+		if k == "ack" {
+			ack = v
+		}
+	}
+	return ack, nil
+}
+
+// chunkID returns a random 128 bit id, base64 encoded.
+func chunkID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(id), nil
+}
+
+func (f *forward) dial() error {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	var conn net.Conn
+	var err error
+	if f.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", f.address, f.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", f.address)
+	}
+	if err != nil {
+		return err
+	}
+
+	f.conn = conn
+	f.reader = bufio.NewReader(conn)
+	return nil
+}
+
+// Close closes the logChannel and the
+// connection. Anything already on the
+// stack will get flushed.
+func (f *forward) Close() {
+	close(f.logChannel)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.conn != nil {
+		f.conn.Close()
+		f.conn = nil
+	}
+}
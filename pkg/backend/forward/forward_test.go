@@ -0,0 +1,256 @@
+package forward
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+// message is a decoded PackedForward message.
+type message struct {
+	tag     string
+	entries []entry
+	options map[string]string
+}
+
+type entry struct {
+	time   time.Time
+	record map[string]string
+}
+
+// aggregator imitates a Fluent Bit in_forward input, acking
+// chunks on every connection but the dropped first ones.
+type aggregator struct {
+	listener net.Listener
+	drop     int
+	messages chan message
+}
+
+func newAggregator(t *testing.T, drop int) *aggregator {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	a := &aggregator{listener: listener, drop: drop, messages: make(chan message, 10)}
+	go a.serve(t)
+	return a
+}
+
+func (a *aggregator) serve(t *testing.T) {
+	for {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		r := bufio.NewReader(conn)
+		for {
+			m, err := readMessage(r)
+			if err != nil {
+				break
+			}
+
+			if a.drop > 0 {
+				a.drop--
+				break
+			}
+			a.messages <- m
+
+			if chunk, ok := m.options["chunk"]; ok {
+				ack := appendMapHeader(nil, 1)
+				ack = appendString(ack, "ack")
+				ack = appendString(ack, chunk)
+				conn.Write(ack)
+			}
+		}
+		conn.Close()
+	}
+}
+
+func readMessage(r *bufio.Reader) (message, error) {
+	m := message{options: map[string]string{}}
+
+	if _, err := r.ReadByte(); err != nil {
+		return m, err
+	}
+
+	tag, err := readString(r)
+	if err != nil {
+		return m, err
+	}
+	m.tag = tag
+
+	entries, err := readString(r)
+	if err != nil {
+		return m, err
+	}
+
+	er := bufio.NewReader(strings.NewReader(entries))
+	for {
+		if _, err := er.ReadByte(); err == io.EOF {
+			break
+		}
+
+		ext := make([]byte, 10)
+		io.ReadFull(er, ext)
+		e := entry{
+			time:   time.Unix(int64(binary.BigEndian.Uint32(ext[2:])), int64(binary.BigEndian.Uint32(ext[6:]))),
+			record: map[string]string{},
+		}
+
+		n, err := readMapHeader(er)
+		if err != nil {
+			return m, err
+		}
+		for i := 0; i < n; i++ {
+			k, _ := readString(er)
+			v, _ := readString(er)
+			e.record[k] = v
+		}
+		m.entries = append(m.entries, e)
+	}
+
+	n, err := readMapHeader(r)
+	if err != nil {
+		return m, err
+	}
+	for i := 0; i < n; i++ {
+		k, _ := readString(r)
+		if k == "size" {
+			size, _ := r.ReadByte()
+			m.options[k] = string('0' + size)
+			continue
+		}
+		m.options[k], _ = readString(r)
+	}
+
+	return m, nil
+}
+
+func Test_Build(t *testing.T) {
+	ch := make(chan backend.RawLog)
+	errCh := make(chan error)
+
+	f := New().Address("127.0.0.1:24224").LogChannel(ch).ErrChannel(errCh).Build()
+
+	assert.Equal(t, "127.0.0.1:24224", f.address)
+	assert.Equal(t, ch, f.logChannel)
+	assert.Equal(t, errCh, f.errChannel)
+	assert.Equal(t, DefaultBatchSize, f.batchSize)
+	assert.Equal(t, DefaultFlushInterval, f.flushInterval)
+	assert.False(t, f.ack)
+
+	tag, err := f.renderTag(map[string]string{"namespace": "hello", "pod": "world-7d4b9c-x2k8p", "container": "world"})
+	assert.Nil(t, err)
+	assert.Equal(t, "hello.world", tag)
+}
+
+func Test_readString(t *testing.T) {
+	for _, n := range []int{0, 31, 32, 255, 256, 65536} {
+		s := strings.Repeat("a", n)
+
+		b := appendString(nil, s)
+		v, err := readString(bufio.NewReader(strings.NewReader(string(b))))
+		assert.Nil(t, err)
+		assert.Equal(t, s, v)
+
+		b = appendBin(nil, []byte(s))
+		v, err = readString(bufio.NewReader(strings.NewReader(string(b))))
+		assert.Nil(t, err)
+		assert.Equal(t, s, v)
+	}
+
+	for _, n := range []int{0, 15, 16, 65536} {
+		b := appendMapHeader(nil, n)
+		v, err := readMapHeader(bufio.NewReader(strings.NewReader(string(b))))
+		assert.Nil(t, err)
+		assert.Equal(t, n, v)
+	}
+}
+
+func Test_Stream(t *testing.T) {
+	a := newAggregator(t, 0)
+	defer a.listener.Close()
+
+	ch := make(chan backend.RawLog, 3)
+	errCh := make(chan error, 1)
+
+	tag := template.Must(template.New("tag").Parse("kube.{{.namespace}}"))
+	f := New().Address(a.listener.Addr().String()).Tag(tag).LogChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- backend.RawLog{Log: "first", Timestamp: "1696118400123456789", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	ch <- backend.RawLog{Log: "second", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	ch <- backend.RawLog{Log: "other", Metadata: map[string]string{"namespace": "other"}}
+	f.Close()
+	f.Stream()
+
+	messages := map[string]message{}
+	for i := 0; i < 2; i++ {
+		select {
+		case m := <-a.messages:
+			messages[m.tag] = m
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the messages")
+		}
+	}
+
+	m := messages["kube.hello"]
+	assert.Equal(t, "2", m.options["size"])
+	assert.Len(t, m.entries, 2)
+	assert.Equal(t, time.Unix(0, 1696118400123456789), m.entries[0].time)
+	assert.Equal(t, map[string]string{"log": "first", "namespace": "hello", "pod": "world"}, m.entries[0].record)
+	assert.Equal(t, "second", m.entries[1].record["log"])
+
+	m = messages["kube.other"]
+	assert.Equal(t, "1", m.options["size"])
+	assert.Equal(t, map[string]string{"log": "other", "namespace": "other"}, m.entries[0].record)
+
+	assert.Empty(t, errCh)
+}
+
+func Test_StreamAck(t *testing.T) {
+	// drop the first chunk without acking it
+	a := newAggregator(t, 1)
+	defer a.listener.Close()
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	f := New().Address(a.listener.Addr().String()).Ack(true, time.Second).LogChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- backend.RawLog{Log: "some log", Metadata: map[string]string{"namespace": "hello", "pod": "world-7d4b9c-x2k8p", "container": "world"}}
+	f.Close()
+	f.Stream()
+
+	m := <-a.messages
+	assert.Equal(t, "hello.world", m.tag)
+	assert.NotEmpty(t, m.options["chunk"])
+	assert.Equal(t, "some log", m.entries[0].record["log"])
+	assert.Empty(t, errCh)
+}
+
+func Test_StreamErr(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	f := New().Address(address).LogChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- backend.RawLog{Log: "some log", Metadata: map[string]string{"namespace": "hello", "pod": "world-7d4b9c-x2k8p", "container": "world"}}
+	f.Close()
+	f.Stream()
+
+	err = <-errCh
+	assert.Contains(t, err.Error(), "dropped 1 logs tagged hello.world")
+}
@@ -0,0 +1,157 @@
+package forward
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// The functions below encode the few MessagePack types
+// the Forward protocol is made of, and decode the map
+// servers acknowledge chunks with.
+
+func appendString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= 0xff:
+		b = append(b, 0xd9, byte(n))
+	case n <= 0xffff:
+		b = append(b, 0xda)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 0xdb)
+		b = binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendBin(b []byte, data []byte) []byte {
+	n := len(data)
+	switch {
+	case n <= 0xff:
+		b = append(b, 0xc4, byte(n))
+	case n <= 0xffff:
+		b = append(b, 0xc5)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 0xc6)
+		b = binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+	return append(b, data...)
+}
+
+func appendArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= 0xffff:
+		b = append(b, 0xdc)
+		return binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 0xdd)
+		return binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+}
+
+func appendMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= 0xffff:
+		b = append(b, 0xde)
+		return binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 0xdf)
+		return binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+}
+
+func appendUint(b []byte, n uint64) []byte {
+	switch {
+	case n < 128:
+		return append(b, byte(n))
+	case n <= 0xff:
+		return append(b, 0xcc, byte(n))
+	case n <= 0xffff:
+		b = append(b, 0xcd)
+		return binary.BigEndian.AppendUint16(b, uint16(n))
+	case n <= 0xffffffff:
+		b = append(b, 0xce)
+		return binary.BigEndian.AppendUint32(b, uint32(n))
+	default:
+		b = append(b, 0xcf)
+		return binary.BigEndian.AppendUint64(b, n)
+	}
+}
+
+// appendEventTime encodes the EventTime extension,
+// which keeps the nanoseconds of the timestamp.
+func appendEventTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xd7, 0x00)
+	b = binary.BigEndian.AppendUint32(b, uint32(t.Unix()))
+	return binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+}
+
+func readMapHeader(r *bufio.Reader) (int, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case c&0xf0 == 0x80:
+		return int(c & 0x0f), nil
+	case c == 0xde:
+		n, err := readUint(r, 2)
+		return int(n), err
+	case c == 0xdf:
+		n, err := readUint(r, 4)
+		return int(n), err
+	}
+	return 0, fmt.Errorf("forward: expected a map, got 0x%x", c)
+}
+
+func readString(r *bufio.Reader) (string, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+
+	var n uint64
+	switch {
+	case c&0xe0 == 0xa0:
+		n = uint64(c & 0x1f)
+	case c == 0xd9, c == 0xc4:
+		n, err = readUint(r, 1)
+	case c == 0xda, c == 0xc5:
+		n, err = readUint(r, 2)
+	case c == 0xdb, c == 0xc6:
+		n, err = readUint(r, 4)
+	default:
+		return "", fmt.Errorf("forward: expected a string, got 0x%x", c)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	s := make([]byte, n)
+	_, err = io.ReadFull(r, s)
+	return string(s), err
+}
+
+func readUint(r *bufio.Reader, size int) (uint64, error) {
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, err
+	}
+
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
@@ -0,0 +1,140 @@
+package gchat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+)
+
+const (
+	warningColor = "#d93025"
+	normalColor  = "#188038"
+)
+
+// The types below mirror the subset of the Google Chat
+// Cards v2 schema that admiral renders events into.
+
+type cardV2 struct {
+	CardID string `json:"cardId"`
+	Card   card   `json:"card"`
+}
+
+type card struct {
+	Header   header    `json:"header"`
+	Sections []section `json:"sections"`
+}
+
+type header struct {
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle,omitempty"`
+}
+
+type section struct {
+	Widgets []widget `json:"widgets"`
+}
+
+type widget struct {
+	DecoratedText *decoratedText `json:"decoratedText,omitempty"`
+	ButtonList    *buttonList    `json:"buttonList,omitempty"`
+}
+
+type decoratedText struct {
+	TopLabel  string `json:"topLabel,omitempty"`
+	Text      string `json:"text"`
+	WrapText  bool   `json:"wrapText,omitempty"`
+	StartIcon *icon  `json:"startIcon,omitempty"`
+}
+
+type icon struct {
+	MaterialIcon materialIcon `json:"materialIcon"`
+}
+
+type materialIcon struct {
+	Name string `json:"name"`
+}
+
+type buttonList struct {
+	Buttons []cardButton `json:"buttons"`
+}
+
+type cardButton struct {
+	Text    string  `json:"text"`
+	OnClick onClick `json:"onClick"`
+}
+
+type onClick struct {
+	OpenLink openLink `json:"openLink"`
+}
+
+type openLink struct {
+	URL string `json:"url"`
+}
+
+// eventToCard lays the event out as a Cards v2 message:
+// a header with the reason and cluster, a severity line,
+// one widget per configured field and the buttons.
+func (g *gchat) eventToCard(event backend.Event) (*gchatDTO, error) {
+	widgets := []widget{severityWidget(event)}
+
+	for _, name := range g.fields {
+		value, ok := event.Field(name)
+		if !ok {
+			continue
+		}
+
+		widgets = append(widgets, widget{
+			DecoratedText: &decoratedText{
+				TopLabel: name,
+				Text:     value,
+				WrapText: true,
+			},
+		})
+	}
+
+	if len(g.buttons) > 0 {
+		buttons := []cardButton{}
+		for _, b := range g.buttons {
+			var url strings.Builder
+			if err := b.url.Execute(&url, event.Fields()); err != nil {
+				return nil, err
+			}
+
+			buttons = append(buttons, cardButton{
+				Text:    b.text,
+				OnClick: onClick{OpenLink: openLink{URL: url.String()}},
+			})
+		}
+		widgets = append(widgets, widget{ButtonList: &buttonList{Buttons: buttons}})
+	}
+
+	return &gchatDTO{
+		CardsV2: []cardV2{
+			{
+				CardID: "admiral",
+				Card: card{
+					Header: header{
+						Title:    event.Reason,
+						Subtitle: event.Cluster,
+					},
+					Sections: []section{{Widgets: widgets}},
+				},
+			},
+		},
+	}, nil
+}
+
+func severityWidget(event backend.Event) widget {
+	color, iconName := normalColor, "info"
+	if event.IsWarning() {
+		color, iconName = warningColor, "warning"
+	}
+
+	return widget{
+		DecoratedText: &decoratedText{
+			TopLabel:  "type",
+			Text:      fmt.Sprintf(`<font color="%s">%s</font>`, color, event.Type),
+			StartIcon: &icon{MaterialIcon: materialIcon{Name: iconName}},
+		},
+	}
+}
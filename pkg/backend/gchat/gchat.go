@@ -2,15 +2,32 @@ package gchat
 
 import (
 	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
 
+	"github.com/phil-inc/admiral/pkg/backend"
 	"github.com/phil-inc/admiral/pkg/utils"
 )
 
+const (
+	FormatText = "text"
+	FormatCard = "card"
+
+	// replyOption makes messages with a threadKey reply
+	// to the matching thread, or start it if there is none.
+	replyOption = "REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD"
+)
+
 type Builder struct {
-	url         string
-	client      *http.Client
-	textChannel chan string
-	errChannel  chan error
+	url          string
+	client       *http.Client
+	eventChannel chan backend.Event
+	errChannel   chan error
+	format       string
+	fields       []string
+	buttons      []button
+	threadKey    *template.Template
 }
 
 // New returns a builder for the gchat struct.
@@ -24,10 +41,10 @@ func (b *Builder) Url(url string) *Builder {
 	return b
 }
 
-// TextChannel sets the channel from where
-// gchat will take messages.
-func (b *Builder) TextChannel(textChannel chan string) *Builder {
-	b.textChannel = textChannel
+// EventChannel sets the channel from where
+// gchat will take events.
+func (b *Builder) EventChannel(eventChannel chan backend.Event) *Builder {
+	b.eventChannel = eventChannel
 	return b
 }
 
@@ -44,48 +61,151 @@ func (b *Builder) Client(client *http.Client) *Builder {
 	return b
 }
 
+// Format sets the message format, either
+// FormatText (default) or FormatCard.
+func (b *Builder) Format(format string) *Builder {
+	b.format = format
+	return b
+}
+
+// Fields sets which event fields are shown,
+// in order, as key/value widgets on a card.
+func (b *Builder) Fields(fields []string) *Builder {
+	b.fields = fields
+	return b
+}
+
+// Button adds a button to the card linking to
+// the URL rendered from the event fields by the template.
+func (b *Builder) Button(text string, url *template.Template) *Builder {
+	b.buttons = append(b.buttons, button{text: text, url: url})
+	return b
+}
+
+// ThreadKey sets the template rendering the thread key from the
+// event fields, so that events with the same key share a thread.
+func (b *Builder) ThreadKey(threadKey *template.Template) *Builder {
+	b.threadKey = threadKey
+	return b
+}
+
 // Build returns a configured gchat struct.
 func (b *Builder) Build() *gchat {
+	u := b.url
+	if b.threadKey != nil {
+		u = withReplyOption(u)
+	}
+
+	format := b.format
+	if format == "" {
+		format = FormatText
+	}
+
+	fields := b.fields
+	if len(fields) == 0 {
+		fields = backend.DefaultFields
+	}
+
 	return &gchat{
-		url:         b.url,
-		client:      b.client,
-		textChannel: b.textChannel,
-		errChannel:  b.errChannel,
+		url:          u,
+		client:       b.client,
+		eventChannel: b.eventChannel,
+		errChannel:   b.errChannel,
+		format:       format,
+		fields:       fields,
+		buttons:      b.buttons,
+		threadKey:    b.threadKey,
 	}
 }
 
+func withReplyOption(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+
+	q := parsed.Query()
+	q.Set("messageReplyOption", replyOption)
+	parsed.RawQuery = q.Encode()
+
+	return parsed.String()
+}
+
 type gchat struct {
-	url         string
-	client      *http.Client
-	textChannel chan string
-	errChannel  chan error
+	url          string
+	client       *http.Client
+	eventChannel chan backend.Event
+	errChannel   chan error
+	format       string
+	fields       []string
+	buttons      []button
+	threadKey    *template.Template
+}
+
+type button struct {
+	text string
+	url  *template.Template
 }
 
 type gchatDTO struct {
-	Text string `json:"text"`
+	Text    string   `json:"text,omitempty"`
+	CardsV2 []cardV2 `json:"cardsV2,omitempty"`
+	Thread  *thread  `json:"thread,omitempty"`
+}
+
+type thread struct {
+	ThreadKey string `json:"threadKey"`
 }
 
 // Stream waits to receive something
-// on textChannel, then POSTs it to gchat.
+// on eventChannel, then POSTs it to gchat.
 func (g *gchat) Stream() {
-	for msg := range g.textChannel {
-		dto := msgToDTO(msg)
+	for event := range g.eventChannel {
+		dto, err := g.eventToDTO(event)
+		if err != nil {
+			g.errChannel <- err
+			continue
+		}
 
-		err := utils.Send(dto, "POST", g.url, g.client)
+		err = utils.Send(dto, "POST", g.url, g.client)
 		if err != nil {
 			g.errChannel <- err
 		}
 	}
 }
 
+func (g *gchat) eventToDTO(event backend.Event) (*gchatDTO, error) {
+	var dto *gchatDTO
+	var err error
+
+	if g.format == FormatCard {
+		dto, err = g.eventToCard(event)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		dto = msgToDTO(event.String())
+	}
+
+	if g.threadKey != nil {
+		var key strings.Builder
+		if err := g.threadKey.Execute(&key, event.Fields()); err != nil {
+			return nil, err
+		}
+		dto.Thread = &thread{ThreadKey: key.String()}
+	}
+
+	return dto, nil
+}
+
 func msgToDTO(text string) *gchatDTO {
 	return &gchatDTO{
 		Text: text,
 	}
 }
 
-// Close closes the textChannel. Anything
+// Close closes the eventChannel. Anything
 // already on the stack will get processed.
 func (g *gchat) Close() {
-	close(g.textChannel)
+	close(g.eventChannel)
 }
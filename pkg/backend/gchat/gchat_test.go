@@ -5,21 +5,23 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"text/template"
 
+	"github.com/phil-inc/admiral/pkg/backend"
 	"github.com/phil-inc/admiral/pkg/utils"
 	"github.com/stretchr/testify/assert"
 )
 
 func Test_Build(t *testing.T) {
 	cli := &http.Client{}
-	ch := make(chan string)
+	ch := make(chan backend.Event)
 
-	g := New().Client(cli).TextChannel(ch).Url("gchat.com").Build()
+	g := New().Client(cli).EventChannel(ch).Url("gchat.com").Build()
 
 	assert.NotNil(t, g)
 	assert.Equal(t, "gchat.com", g.url)
 	assert.NotNil(t, g.client)
-	assert.Equal(t, ch, g.textChannel)
+	assert.Equal(t, ch, g.eventChannel)
 }
 
 func Test_Stream(t *testing.T) {
@@ -32,16 +34,16 @@ func Test_Stream(t *testing.T) {
 	}))
 
 	cli := &http.Client{}
-	ch := make(chan string)
+	ch := make(chan backend.Event)
 	errCh := make(chan error)
 
-	g := New().Client(cli).Url(server.URL).TextChannel(ch).ErrChannel(errCh).Build()
+	g := New().Client(cli).Url(server.URL).EventChannel(ch).ErrChannel(errCh).Build()
 
 	go g.Stream()
 
-	msg := "some event"
+	event := backend.Event{Message: "some event"}
 
-	g.textChannel <- msg
+	g.eventChannel <- event
 
 	g.Close()
 }
@@ -54,18 +56,90 @@ func Test_StreamErr(t *testing.T) {
 	}))
 
 	cli := &http.Client{}
-	ch := make(chan string)
+	ch := make(chan backend.Event)
 	errCh := make(chan error)
 
-	g := New().ErrChannel(errCh).Url(server.URL).Client(cli).TextChannel(ch).Build()
+	g := New().ErrChannel(errCh).Url(server.URL).Client(cli).EventChannel(ch).Build()
 
 	go utils.HandleErrorStream(errCh)
 	defer close(errCh)
 	go g.Stream()
 
-	msg := "my event"
+	event := backend.Event{Message: "my event"}
 
-	g.textChannel <- msg
+	g.eventChannel <- event
+
+	g.Close()
+}
+
+func Test_eventToCard(t *testing.T) {
+	url := template.Must(template.New("logs").Parse("https://grafana.com/explore?ns={{.namespace}}&pod={{.object}}"))
+
+	g := New().Format(FormatCard).Fields([]string{"namespace", "object"}).Button("Logs", url).Build()
+
+	event := backend.Event{
+		Cluster:   "hello-cluster",
+		Namespace: "hello-namespace",
+		Name:      "hello-pod",
+		Reason:    "BackOff",
+		Type:      "Warning",
+	}
+
+	dto, err := g.eventToDTO(event)
+	assert.Nil(t, err)
+	assert.Empty(t, dto.Text)
+	assert.Len(t, dto.CardsV2, 1)
+
+	c := dto.CardsV2[0].Card
+	assert.Equal(t, "BackOff", c.Header.Title)
+	assert.Equal(t, "hello-cluster", c.Header.Subtitle)
+
+	widgets := c.Sections[0].Widgets
+	assert.Len(t, widgets, 4)
+	assert.Contains(t, widgets[0].DecoratedText.Text, warningColor)
+	assert.Equal(t, "warning", widgets[0].DecoratedText.StartIcon.MaterialIcon.Name)
+	assert.Equal(t, "namespace", widgets[1].DecoratedText.TopLabel)
+	assert.Equal(t, "hello-namespace", widgets[1].DecoratedText.Text)
+	assert.Equal(t, "hello-pod", widgets[2].DecoratedText.Text)
+	assert.Equal(t, "Logs", widgets[3].ButtonList.Buttons[0].Text)
+	assert.Equal(t, "https://grafana.com/explore?ns=hello-namespace&pod=hello-pod", widgets[3].ButtonList.Buttons[0].OnClick.OpenLink.URL)
+
+	event.Type = "Normal"
+	dto, err = g.eventToDTO(event)
+	assert.Nil(t, err)
+	assert.Contains(t, dto.CardsV2[0].Card.Sections[0].Widgets[0].DecoratedText.Text, normalColor)
+}
+
+func Test_eventToText(t *testing.T) {
+	g := New().Build()
+
+	dto, err := g.eventToDTO(backend.Event{Message: "some event"})
+	assert.Nil(t, err)
+	assert.Contains(t, dto.Text, "some event")
+	assert.Empty(t, dto.CardsV2)
+}
+
+func Test_Thread(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "abc", r.URL.Query().Get("key"))
+		assert.Equal(t, "REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD", r.URL.Query().Get("messageReplyOption"))
+
+		b, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.Contains(t, string(b), `"threadKey":"hello-cluster/hello-node/NodeNotReady"`)
+	}))
+
+	threadKey := template.Must(template.New("threadKey").Parse("{{.cluster}}/{{.object}}/{{.reason}}"))
+
+	cli := &http.Client{}
+	ch := make(chan backend.Event)
+	errCh := make(chan error)
+
+	g := New().Client(cli).Url(server.URL + "?key=abc").ThreadKey(threadKey).EventChannel(ch).ErrChannel(errCh).Build()
+
+	go g.Stream()
+
+	g.eventChannel <- backend.Event{Cluster: "hello-cluster", Name: "hello-node", Reason: "NodeNotReady"}
 
 	g.Close()
 }
@@ -0,0 +1,318 @@
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+)
+
+const (
+	TransportUDP = "udp"
+	TransportTCP = "tcp"
+	TransportTLS = "tls"
+
+	// DefaultChunkSize keeps UDP datagrams
+	// within the MTU of most networks.
+	DefaultChunkSize = 1420
+
+	// levels are syslog severities
+	levelInfo = 6
+
+	dialTimeout = 10 * time.Second
+
+	// chunkHeaderLength is the length of the magic bytes,
+	// message id, sequence number and sequence count.
+	chunkHeaderLength = 12
+	maxChunks         = 128
+)
+
+var chunkMagic = []byte{0x1e, 0x0f}
+
+// invalidFieldChars are the characters Graylog
+// doesn't accept in additional field names.
+var invalidFieldChars = regexp.MustCompile(`[^\w.\-]`)
+
+type Builder struct {
+	transport  string
+	address    string
+	tlsConfig  *tls.Config
+	logChannel chan backend.RawLog
+	errChannel chan error
+	chunkSize  int
+	compress   bool
+}
+
+// New returns a builder for the gelf struct.
+func New() *Builder {
+	return &Builder{}
+}
+
+// Transport sets how messages are sent: TransportUDP
+// (default), TransportTCP or TransportTLS.
+func (b *Builder) Transport(transport string) *Builder {
+	b.transport = transport
+	return b
+}
+
+// Address sets the host:port of the Graylog input.
+func (b *Builder) Address(address string) *Builder {
+	b.address = address
+	return b
+}
+
+// TLSConfig sets the configuration of TransportTLS.
+func (b *Builder) TLSConfig(tlsConfig *tls.Config) *Builder {
+	b.tlsConfig = tlsConfig
+	return b
+}
+
+// LogChannel sets the channel from where
+// gelf will take logs.
+func (b *Builder) LogChannel(logChannel chan backend.RawLog) *Builder {
+	b.logChannel = logChannel
+	return b
+}
+
+// ErrChannel sets the channel where gelf
+// will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// ChunkSize sets the largest UDP datagram,
+// above which messages are chunked.
+func (b *Builder) ChunkSize(chunkSize int) *Builder {
+	b.chunkSize = chunkSize
+	return b
+}
+
+// Compress gzips the UDP messages
+// which don't fit in one datagram.
+func (b *Builder) Compress(compress bool) *Builder {
+	b.compress = compress
+	return b
+}
+
+// Build returns a configured gelf struct.
+func (b *Builder) Build() *gelf {
+	g := &gelf{
+		transport:  b.transport,
+		address:    b.address,
+		tlsConfig:  b.tlsConfig,
+		logChannel: b.logChannel,
+		errChannel: b.errChannel,
+		chunkSize:  b.chunkSize,
+		compress:   b.compress,
+	}
+
+	if g.transport == "" {
+		g.transport = TransportUDP
+	}
+	if g.chunkSize <= chunkHeaderLength {
+		g.chunkSize = DefaultChunkSize
+	}
+
+	// GELF requires a host, which logs
+	// without a pod label fall back to
+	g.hostname, _ = os.Hostname()
+
+	return g
+}
+
+type gelf struct {
+	transport  string
+	address    string
+	tlsConfig  *tls.Config
+	logChannel chan backend.RawLog
+	errChannel chan error
+	chunkSize  int
+	compress   bool
+	hostname   string
+	conn       net.Conn
+	mutex      sync.Mutex
+}
+
+// Stream sends whatever is received on
+// logChannel to the Graylog input.
+func (g *gelf) Stream() {
+	for raw := range g.logChannel {
+		msg, err := json.Marshal(g.rawLogToMessage(raw))
+		if err != nil {
+			g.errChannel <- err
+			continue
+		}
+
+		if err := g.send(msg); err != nil {
+			g.errChannel <- err
+		}
+	}
+}
+
+// rawLogToMessage lays the log out as a GELF 1.1
+// message, with its labels as additional fields.
+func (g *gelf) rawLogToMessage(r backend.RawLog) map[string]interface{} {
+	t := time.Now()
+	if ns, err := strconv.ParseInt(r.Timestamp, 10, 64); err == nil {
+		t = time.Unix(0, ns)
+	}
+
+	host := r.Metadata["pod"]
+	if host == "" {
+		host = g.hostname
+	}
+
+	msg := map[string]interface{}{
+		"version":       "1.1",
+		"host":          host,
+		"short_message": r.Log,
+		"timestamp":     float64(t.UnixMicro()) / 1e6,
+		"level":         levelInfo,
+	}
+
+	for k, v := range r.Metadata {
+		field := "_" + invalidFieldChars.ReplaceAllString(k, "_")
+		// _id is reserved by Graylog
+		if field == "_id" {
+			field = "_label_id"
+		}
+		msg[field] = v
+	}
+
+	return msg
+}
+
+// send writes the message, reconnecting and
+// retrying once if the connection was dropped.
+func (g *gelf) send(msg []byte) error {
+	packets := [][]byte{append(msg, 0)}
+	if g.transport == TransportUDP {
+		var err error
+		if packets, err = g.packets(msg); err != nil {
+			return err
+		}
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if g.conn == nil {
+			g.conn, err = g.dial()
+			if err != nil {
+				continue
+			}
+		}
+
+		if err = write(g.conn, packets); err == nil {
+			return nil
+		}
+
+		g.conn.Close()
+		g.conn = nil
+	}
+
+	return err
+}
+
+func write(conn net.Conn, packets [][]byte) error {
+	for _, p := range packets {
+		if _, err := conn.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packets splits the message into the UDP datagrams
+// it is sent in, gzipping it first if it is enabled
+// and the message doesn't fit in one datagram.
+func (g *gelf) packets(msg []byte) ([][]byte, error) {
+	if len(msg) <= g.chunkSize {
+		return [][]byte{msg}, nil
+	}
+
+	if g.compress {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(msg); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		msg = buf.Bytes()
+		if len(msg) <= g.chunkSize {
+			return [][]byte{msg}, nil
+		}
+	}
+
+	size := g.chunkSize - chunkHeaderLength
+	count := (len(msg) + size - 1) / size
+	if count > maxChunks {
+		return nil, fmt.Errorf("gelf: message of %d bytes needs more than %d chunks", len(msg), maxChunks)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	packets := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(msg) {
+			end = len(msg)
+		}
+
+		p := make([]byte, 0, chunkHeaderLength+end-i*size)
+		p = append(p, chunkMagic...)
+		p = append(p, id...)
+		p = append(p, byte(i), byte(count))
+		p = append(p, msg[i*size:end]...)
+		packets = append(packets, p)
+	}
+
+	return packets, nil
+}
+
+func (g *gelf) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	switch g.transport {
+	case TransportTLS:
+		return tls.DialWithDialer(dialer, "tcp", g.address, g.tlsConfig)
+	case TransportTCP:
+		return dialer.Dial("tcp", g.address)
+	default:
+		return dialer.Dial("udp", g.address)
+	}
+}
+
+// Close closes the logChannel and the
+// connection. Anything already on the
+// stack will get processed.
+func (g *gelf) Close() {
+	close(g.logChannel)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.conn != nil {
+		g.conn.Close()
+		g.conn = nil
+	}
+}
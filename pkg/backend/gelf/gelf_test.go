@@ -0,0 +1,176 @@
+package gelf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Build(t *testing.T) {
+	ch := make(chan backend.RawLog)
+	errCh := make(chan error)
+
+	g := New().Address("127.0.0.1:12201").LogChannel(ch).ErrChannel(errCh).Build()
+
+	assert.Equal(t, TransportUDP, g.transport)
+	assert.Equal(t, "127.0.0.1:12201", g.address)
+	assert.Equal(t, ch, g.logChannel)
+	assert.Equal(t, errCh, g.errChannel)
+	assert.Equal(t, DefaultChunkSize, g.chunkSize)
+	assert.False(t, g.compress)
+}
+
+func Test_rawLogToMessage(t *testing.T) {
+	g := New().Build()
+
+	msg := g.rawLogToMessage(backend.RawLog{
+		Log:       "some log",
+		Timestamp: "1696118400123456789",
+		Metadata:  map[string]string{"pod": "world", "app.kubernetes.io/name": "hello", "id": "1"},
+	})
+
+	assert.Equal(t, map[string]interface{}{
+		"version":                 "1.1",
+		"host":                    "world",
+		"short_message":           "some log",
+		"timestamp":               1696118400.123456,
+		"level":                   levelInfo,
+		"_pod":                    "world",
+		"_app.kubernetes.io_name": "hello",
+		"_label_id":               "1",
+	}, msg)
+
+	msg = g.rawLogToMessage(backend.RawLog{Log: "some log"})
+	assert.Equal(t, g.hostname, msg["host"])
+}
+
+// reassemble joins the chunks of a message,
+// ungzipping it if it is compressed.
+func reassemble(t *testing.T, packets [][]byte) []byte {
+	var msg []byte
+	for i, p := range packets {
+		if !bytes.HasPrefix(p, chunkMagic) {
+			msg = p
+			break
+		}
+
+		assert.Equal(t, packets[0][2:10], p[2:10])
+		assert.Equal(t, byte(i), p[10])
+		assert.Equal(t, byte(len(packets)), p[11])
+		msg = append(msg, p[chunkHeaderLength:]...)
+	}
+
+	if bytes.HasPrefix(msg, []byte{0x1f, 0x8b}) {
+		r, err := gzip.NewReader(bytes.NewReader(msg))
+		assert.Nil(t, err)
+		msg, err = io.ReadAll(r)
+		assert.Nil(t, err)
+	}
+
+	return msg
+}
+
+func Test_packets(t *testing.T) {
+	msg := []byte(`{"short_message":"` + strings.Repeat("a", 300) + `"}`)
+
+	g := New().ChunkSize(112).Build()
+
+	packets, err := g.packets(msg)
+	assert.Nil(t, err)
+	assert.Len(t, packets, 4)
+	for _, p := range packets {
+		assert.LessOrEqual(t, len(p), 112)
+	}
+	assert.Equal(t, msg, reassemble(t, packets))
+
+	g = New().ChunkSize(112).Compress(true).Build()
+
+	packets, err = g.packets(msg)
+	assert.Nil(t, err)
+	assert.Len(t, packets, 1)
+	assert.Equal(t, msg, reassemble(t, packets))
+
+	packets, err = New().ChunkSize(13).Build().packets(msg)
+	assert.Nil(t, packets)
+	assert.Contains(t, err.Error(), "needs more than 128 chunks")
+}
+
+func Test_StreamUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	g := New().Address(conn.LocalAddr().String()).ChunkSize(200).LogChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- backend.RawLog{Log: strings.Repeat("a", 500), Metadata: map[string]string{"pod": "world"}}
+	close(ch)
+	g.Stream()
+
+	packets := [][]byte{}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for len(packets) == 0 || len(packets) < int(packets[0][11]) {
+		buf := make([]byte, 1024)
+		n, _, err := conn.ReadFrom(buf)
+		assert.Nil(t, err)
+		packets = append(packets, buf[:n])
+	}
+
+	msg := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(reassemble(t, packets), &msg))
+	assert.Equal(t, strings.Repeat("a", 500), msg["short_message"])
+	assert.Equal(t, "world", msg["host"])
+	assert.Empty(t, errCh)
+}
+
+func Test_StreamTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	received := make(chan string, 2)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		for i := 0; i < 2; i++ {
+			msg, _ := r.ReadString(0)
+			received <- msg
+		}
+	}()
+
+	ch := make(chan backend.RawLog, 2)
+	errCh := make(chan error, 1)
+
+	g := New().Transport(TransportTCP).Address(listener.Addr().String()).LogChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- backend.RawLog{Log: "first"}
+	ch <- backend.RawLog{Log: "second"}
+	close(ch)
+	g.Stream()
+
+	for _, log := range []string{"first", "second"} {
+		msg := <-received
+		assert.True(t, strings.HasSuffix(msg, "\x00"))
+
+		m := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal([]byte(strings.TrimSuffix(msg, "\x00")), &m))
+		assert.Equal(t, log, m["short_message"])
+	}
+	assert.Empty(t, errCh)
+}
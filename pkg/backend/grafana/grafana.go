@@ -0,0 +1,174 @@
+package grafana
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/phil-inc/admiral/pkg/utils"
+)
+
+// maxRetries is how many times a rate-limited
+// request is retried before it is dropped.
+const maxRetries = 3
+
+type Builder struct {
+	url          string
+	client       *http.Client
+	eventChannel chan backend.Event
+	errChannel   chan error
+	token        string
+	rules        []rule
+}
+
+// New returns a builder for the grafana struct.
+func New() *Builder {
+	return &Builder{}
+}
+
+// Url sets the url of Grafana.
+func (b *Builder) Url(url string) *Builder {
+	b.url = url
+	return b
+}
+
+// EventChannel sets the channel from where
+// grafana will take events.
+func (b *Builder) EventChannel(eventChannel chan backend.Event) *Builder {
+	b.eventChannel = eventChannel
+	return b
+}
+
+// ErrChannel sets the channel where grafana
+// will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// Client sets the HTTP client.
+func (b *Builder) Client(client *http.Client) *Builder {
+	b.client = client
+	return b
+}
+
+// Token sets the token of the service account
+// annotations are created with.
+func (b *Builder) Token(token string) *Builder {
+	b.token = token
+	return b
+}
+
+// Dashboard adds a rule annotating the dashboard, and
+// its panel unless it is 0, when the event matches the
+// namespace, reason and type. An empty namespace, reason
+// or type matches any, and every matching rule annotates
+// its dashboard.
+func (b *Builder) Dashboard(namespace string, reason string, eventType string, dashboardUID string, panelID int) *Builder {
+	b.rules = append(b.rules, rule{
+		namespace:    namespace,
+		reason:       reason,
+		eventType:    eventType,
+		dashboardUID: dashboardUID,
+		panelID:      panelID,
+	})
+	return b
+}
+
+// Build returns a configured grafana struct.
+func (b *Builder) Build() *grafana {
+	return &grafana{
+		url:          strings.TrimSuffix(b.url, "/"),
+		client:       b.client,
+		eventChannel: b.eventChannel,
+		errChannel:   b.errChannel,
+		headers:      map[string]string{"Authorization": "Bearer " + b.token},
+		rules:        b.rules,
+	}
+}
+
+type grafana struct {
+	url          string
+	client       *http.Client
+	eventChannel chan backend.Event
+	errChannel   chan error
+	headers      map[string]string
+	rules        []rule
+}
+
+type rule struct {
+	namespace    string
+	reason       string
+	eventType    string
+	dashboardUID string
+	panelID      int
+}
+
+type annotationDTO struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	PanelID      int      `json:"panelId,omitempty"`
+	Time         int64    `json:"time"`
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+// Stream waits to receive something on eventChannel, then
+// annotates the dashboards of the matching rules, or the
+// organization when none matches.
+func (g *grafana) Stream() {
+	for event := range g.eventChannel {
+		for _, dto := range g.eventToDTOs(event) {
+			err := utils.SendWithRetry(dto, "POST", g.url+"/api/annotations", g.headers, g.client, maxRetries)
+			if err != nil {
+				g.errChannel <- err
+			}
+		}
+	}
+}
+
+func (g *grafana) eventToDTOs(event backend.Event) []*annotationDTO {
+	t := event.Timestamp
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	tags := []string{"cluster:" + event.Cluster}
+	if event.Namespace != "" {
+		tags = append(tags, "namespace:"+event.Namespace)
+	}
+	tags = append(tags, "reason:"+event.Reason)
+
+	text := fmt.Sprintf("%s %s/%s: %s", event.Reason, strings.ToLower(event.Kind), event.Name, event.Message)
+
+	dtos := []*annotationDTO{}
+	for _, r := range g.rules {
+		if r.matches(event) {
+			dtos = append(dtos, &annotationDTO{
+				DashboardUID: r.dashboardUID,
+				PanelID:      r.panelID,
+				Time:         t.UnixMilli(),
+				Tags:         tags,
+				Text:         text,
+			})
+		}
+	}
+
+	if len(dtos) == 0 {
+		dtos = append(dtos, &annotationDTO{Time: t.UnixMilli(), Tags: tags, Text: text})
+	}
+	return dtos
+}
+
+func (r rule) matches(event backend.Event) bool {
+	return (r.namespace == "" || r.namespace == event.Namespace) &&
+		(r.reason == "" || r.reason == event.Reason) &&
+		(r.eventType == "" || r.eventType == event.Type)
+}
+
+// Close closes the eventChannel. Anything
+// already on the stack will get processed.
+func (g *grafana) Close() {
+	close(g.eventChannel)
+}
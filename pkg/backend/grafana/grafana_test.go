@@ -0,0 +1,120 @@
+package grafana
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+var mocked_event = backend.Event{
+	Cluster:   "hello-cluster",
+	Namespace: "hello-namespace",
+	Kind:      "Node",
+	Name:      "hello-node",
+	Reason:    "NodeNotReady",
+	Type:      "Normal",
+	Message:   "Node hello-node status is now: NodeNotReady",
+	Timestamp: time.UnixMilli(1696118400123),
+}
+
+func Test_Build(t *testing.T) {
+	cli := &http.Client{}
+	ch := make(chan backend.Event)
+
+	g := New().Client(cli).EventChannel(ch).Token("glsa_token").Url("https://grafana.example.com/").Build()
+
+	assert.NotNil(t, g)
+	assert.Equal(t, "https://grafana.example.com", g.url)
+	assert.Equal(t, "Bearer glsa_token", g.headers["Authorization"])
+	assert.Equal(t, ch, g.eventChannel)
+}
+
+func Test_eventToDTOs(t *testing.T) {
+	g := New().
+		Dashboard("", "NodeNotReady", "", "nodes", 0).
+		Dashboard("hello-namespace", "", "Warning", "hello", 4).
+		Dashboard("hello-namespace", "", "", "deploys", 2).
+		Build()
+
+	dtos := g.eventToDTOs(mocked_event)
+	assert.Len(t, dtos, 2)
+	assert.Equal(t, &annotationDTO{
+		DashboardUID: "nodes",
+		Time:         1696118400123,
+		Tags:         []string{"cluster:hello-cluster", "namespace:hello-namespace", "reason:NodeNotReady"},
+		Text:         "NodeNotReady node/hello-node: Node hello-node status is now: NodeNotReady",
+	}, dtos[0])
+	assert.Equal(t, "deploys", dtos[1].DashboardUID)
+	assert.Equal(t, 2, dtos[1].PanelID)
+
+	e := mocked_event
+	e.Namespace = ""
+	e.Reason = "NodeReady"
+
+	dtos = g.eventToDTOs(e)
+	assert.Len(t, dtos, 1)
+	assert.Empty(t, dtos[0].DashboardUID)
+	assert.Equal(t, []string{"cluster:hello-cluster", "reason:NodeReady"}, dtos[0].Tags)
+}
+
+func Test_Stream(t *testing.T) {
+	var mutex sync.Mutex
+	annotations := []map[string]interface{}{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/annotations", r.URL.Path)
+		assert.Equal(t, "Bearer glsa_token", r.Header.Get("Authorization"))
+
+		annotation := map[string]interface{}{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&annotation))
+
+		mutex.Lock()
+		annotations = append(annotations, annotation)
+		mutex.Unlock()
+
+		w.Write([]byte(`{"message":"Annotation added","id":1}`))
+	}))
+
+	ch := make(chan backend.Event, 1)
+	errCh := make(chan error, 1)
+
+	g := New().Client(&http.Client{}).Url(server.URL).Token("glsa_token").Dashboard("", "NodeNotReady", "", "nodes", 3).EventChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- mocked_event
+	g.Close()
+	g.Stream()
+
+	assert.Empty(t, errCh)
+	assert.Equal(t, []map[string]interface{}{{
+		"dashboardUID": "nodes",
+		"panelId":      float64(3),
+		"time":         float64(1696118400123),
+		"tags":         []interface{}{"cluster:hello-cluster", "namespace:hello-namespace", "reason:NodeNotReady"},
+		"text":         "NodeNotReady node/hello-node: Node hello-node status is now: NodeNotReady",
+	}}, annotations)
+}
+
+func Test_StreamErr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message":"invalid API key"}`))
+	}))
+
+	ch := make(chan backend.Event, 1)
+	errCh := make(chan error, 1)
+
+	g := New().Client(&http.Client{}).Url(server.URL).EventChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- mocked_event
+	g.Close()
+	g.Stream()
+
+	err := <-errCh
+	assert.Contains(t, err.Error(), "invalid API key")
+}
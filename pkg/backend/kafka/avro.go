@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"github.com/linkedin/goavro/v2"
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/twmb/franz-go/pkg/sr"
+)
+
+// The Avro schemas of logs and events.
+// Timestamps are in milliseconds.
+const (
+	LogSchema   = `{"name":"admiral.Log","type":"record","fields":[{"name":"timestamp","type":"long"},{"name":"log","type":"string"},{"name":"labels","type":{"type":"map","values":"string"}}]}`
+	EventSchema = `{"name":"admiral.Event","type":"record","fields":[{"name":"timestamp","type":"long"},{"name":"cluster","type":"string"},{"name":"namespace","type":"string"},{"name":"kind","type":"string"},{"name":"name","type":"string"},{"name":"reason","type":"string"},{"name":"type","type":"string"},{"name":"message","type":"string"},{"name":"labels","type":{"type":"map","values":"string"}}]}`
+)
+
+var (
+	logCodec   = mustCodec(LogSchema)
+	eventCodec = mustCodec(EventSchema)
+)
+
+func mustCodec(schema string) *goavro.Codec {
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		panic(err)
+	}
+	return codec
+}
+
+// avroEncode prefixes the datum with its schema, either as
+// the id of a Confluent schema registry when it is set,
+// or else as the fingerprint of single-object encoding.
+func avroEncode(codec *goavro.Codec, schemaID int, datum map[string]interface{}) ([]byte, error) {
+	if schemaID <= 0 {
+		return codec.SingleFromNative(nil, datum)
+	}
+
+	var header sr.ConfluentHeader
+	b, err := header.AppendEncode(nil, schemaID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return codec.BinaryFromNative(b, datum)
+}
+
+func avroLog(schemaID int, timestamp int64, log string, labels map[string]string) ([]byte, error) {
+	return avroEncode(logCodec, schemaID, map[string]interface{}{
+		"timestamp": timestamp,
+		"log":       log,
+		"labels":    avroMap(labels),
+	})
+}
+
+func avroEvent(schemaID int, e backend.Event) ([]byte, error) {
+	return avroEncode(eventCodec, schemaID, map[string]interface{}{
+		"timestamp": e.Timestamp.UnixMilli(),
+		"cluster":   e.Cluster,
+		"namespace": e.Namespace,
+		"kind":      e.Kind,
+		"name":      e.Name,
+		"reason":    e.Reason,
+		"type":      e.Type,
+		"message":   e.Message,
+		"labels":    avroMap(e.Labels),
+	})
+}
+
+func avroMap(m map[string]string) map[string]interface{} {
+	native := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		native[k] = v
+	}
+	return native
+}
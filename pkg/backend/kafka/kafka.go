@@ -0,0 +1,470 @@
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+const (
+	EncodingJSON = "json"
+	EncodingAvro = "avro"
+
+	CompressionNone   = "none"
+	CompressionGzip   = "gzip"
+	CompressionSnappy = "snappy"
+	CompressionLZ4    = "lz4"
+	CompressionZstd   = "zstd"
+
+	SASLPlain       = "PLAIN"
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+
+	AcksNone   = 0
+	AcksLeader = 1
+	AcksAll    = -1
+
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = 5 * time.Second
+
+	// maxRetries is how many times records failing
+	// with a retriable error are produced again, and
+	// how many times a missing topic is looked up.
+	maxRetries = 3
+
+	clientID = "admiral"
+)
+
+var codecs = map[string]kgo.CompressionCodec{
+	CompressionNone:   kgo.NoCompression(),
+	CompressionGzip:   kgo.GzipCompression(),
+	CompressionSnappy: kgo.SnappyCompression(),
+	CompressionLZ4:    kgo.Lz4Compression(),
+	CompressionZstd:   kgo.ZstdCompression(),
+}
+
+type Builder struct {
+	brokers       []string
+	tlsConfig     *tls.Config
+	mechanism     string
+	username      string
+	password      string
+	logChannel    chan backend.RawLog
+	eventChannel  chan backend.Event
+	errChannel    chan error
+	topic         *template.Template
+	encoding      string
+	schemaID      int
+	compression   string
+	acks          int
+	batchSize     int
+	flushInterval time.Duration
+}
+
+// New returns a builder for the kafka struct.
+func New() *Builder {
+	return &Builder{acks: AcksAll}
+}
+
+// Brokers sets the host:port of the
+// brokers metadata is fetched from.
+func (b *Builder) Brokers(brokers []string) *Builder {
+	b.brokers = brokers
+	return b
+}
+
+// TLSConfig enables TLS on the connections.
+func (b *Builder) TLSConfig(tlsConfig *tls.Config) *Builder {
+	b.tlsConfig = tlsConfig
+	return b
+}
+
+// SASL authenticates the connections with the mechanism:
+// SASLPlain, SASLScramSHA256 or SASLScramSHA512.
+func (b *Builder) SASL(mechanism, username, password string) *Builder {
+	b.mechanism = mechanism
+	b.username = username
+	b.password = password
+	return b
+}
+
+// LogChannel sets the channel from where
+// kafka will take logs.
+func (b *Builder) LogChannel(logChannel chan backend.RawLog) *Builder {
+	b.logChannel = logChannel
+	return b
+}
+
+// EventChannel sets the channel from where
+// kafka will take events.
+func (b *Builder) EventChannel(eventChannel chan backend.Event) *Builder {
+	b.eventChannel = eventChannel
+	return b
+}
+
+// ErrChannel sets the channel where kafka
+// will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// Topic sets the template rendering the topic
+// of a log from its labels, or of an event
+// from its fields, along with the watcher,
+// "logs" or "events", it comes from.
+func (b *Builder) Topic(topic *template.Template) *Builder {
+	b.topic = topic
+	return b
+}
+
+// Encoding sets how records are encoded:
+// EncodingJSON (default) or EncodingAvro.
+func (b *Builder) Encoding(encoding string) *Builder {
+	b.encoding = encoding
+	return b
+}
+
+// SchemaID prefixes Avro records with the id of their schema
+// in a Confluent schema registry, instead of its fingerprint.
+func (b *Builder) SchemaID(schemaID int) *Builder {
+	b.schemaID = schemaID
+	return b
+}
+
+// Compression sets the codec of record batches:
+// CompressionNone (default), CompressionGzip,
+// CompressionSnappy, CompressionLZ4 or CompressionZstd.
+func (b *Builder) Compression(compression string) *Builder {
+	b.compression = compression
+	return b
+}
+
+// Acks sets how many replicas must acknowledge
+// records: AcksNone, AcksLeader or AcksAll (default).
+func (b *Builder) Acks(acks int) *Builder {
+	b.acks = acks
+	return b
+}
+
+// Batch sets how many records are buffered
+// at most, and how long, before a flush.
+func (b *Builder) Batch(size int, interval time.Duration) *Builder {
+	b.batchSize = size
+	b.flushInterval = interval
+	return b
+}
+
+// Build returns a configured kafka struct.
+func (b *Builder) Build() *kafka {
+	k := &kafka{
+		logChannel:    b.logChannel,
+		eventChannel:  b.eventChannel,
+		errChannel:    b.errChannel,
+		topic:         b.topic,
+		encoding:      b.encoding,
+		schemaID:      b.schemaID,
+		batchSize:     b.batchSize,
+		flushInterval: b.flushInterval,
+		backoff:       time.Second,
+		brokers:       b.brokers,
+		tlsConfig:     b.tlsConfig,
+		mechanism:     b.mechanism,
+		username:      b.username,
+		password:      b.password,
+		compression:   b.compression,
+		acks:          b.acks,
+	}
+
+	if k.encoding == "" {
+		k.encoding = EncodingJSON
+	}
+	if k.compression == "" {
+		k.compression = CompressionNone
+	}
+	if k.batchSize <= 0 {
+		k.batchSize = DefaultBatchSize
+	}
+	if k.flushInterval <= 0 {
+		k.flushInterval = DefaultFlushInterval
+	}
+
+	return k
+}
+
+type kafka struct {
+	logChannel    chan backend.RawLog
+	eventChannel  chan backend.Event
+	errChannel    chan error
+	topic         *template.Template
+	encoding      string
+	schemaID      int
+	batchSize     int
+	flushInterval time.Duration
+	backoff       time.Duration
+	brokers       []string
+	tlsConfig     *tls.Config
+	mechanism     string
+	username      string
+	password      string
+	compression   string
+	acks          int
+}
+
+// record is a record to produce, and
+// the error of its delivery once it is.
+type record struct {
+	*kgo.Record
+	err error
+}
+
+type logValue struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Log       string            `json:"log"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// Stream buffers logs and events into batches of records,
+// flushing them once the batch is full, at every flush
+// interval, and when both channels are closed.
+func (k *kafka) Stream() {
+	ticker := time.NewTicker(k.flushInterval)
+	defer ticker.Stop()
+
+	client, err := kgo.NewClient(k.options()...)
+	if err != nil {
+		k.errChannel <- fmt.Errorf("kafka: %w", err)
+	} else {
+		defer client.Close()
+	}
+
+	batch := []*record{}
+
+	add := func(r *kgo.Record, err error) {
+		if err != nil {
+			k.errChannel <- err
+			return
+		}
+
+		batch = append(batch, &record{Record: r})
+		if len(batch) >= k.batchSize {
+			k.flush(client, batch)
+			batch = []*record{}
+		}
+	}
+
+	logChannel, eventChannel := k.logChannel, k.eventChannel
+
+	for logChannel != nil || eventChannel != nil {
+		select {
+		case raw, ok := <-logChannel:
+			if !ok {
+				logChannel = nil
+				continue
+			}
+			add(k.rawLogToRecord(raw))
+
+		case event, ok := <-eventChannel:
+			if !ok {
+				eventChannel = nil
+				continue
+			}
+			add(k.eventToRecord(event))
+
+		case <-ticker.C:
+			k.flush(client, batch)
+			batch = []*record{}
+		}
+	}
+
+	k.flush(client, batch)
+}
+
+func (k *kafka) options() []kgo.Opt {
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(k.brokers...),
+		kgo.ClientID(clientID),
+		kgo.ManualFlushing(),
+		kgo.MaxBufferedRecords(k.batchSize),
+		kgo.ProducerBatchCompression(codecs[k.compression]),
+		kgo.RecordRetries(maxRetries),
+		kgo.UnknownTopicRetries(maxRetries),
+		kgo.RetryBackoffFn(func(attempt int) time.Duration {
+			return k.backoff * time.Duration(attempt)
+		}),
+	}
+
+	switch k.acks {
+	case AcksNone:
+		opts = append(opts, kgo.RequiredAcks(kgo.NoAck()), kgo.DisableIdempotentWrite())
+	case AcksLeader:
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()), kgo.DisableIdempotentWrite())
+	default:
+		opts = append(opts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	}
+
+	if k.tlsConfig != nil {
+		opts = append(opts, kgo.DialTLSConfig(k.tlsConfig))
+	}
+
+	switch k.mechanism {
+	case SASLPlain:
+		opts = append(opts, kgo.SASL(plain.Auth{User: k.username, Pass: k.password}.AsMechanism()))
+	case SASLScramSHA256:
+		opts = append(opts, kgo.SASL(scram.Auth{User: k.username, Pass: k.password}.AsSha256Mechanism()))
+	case SASLScramSHA512:
+		opts = append(opts, kgo.SASL(scram.Auth{User: k.username, Pass: k.password}.AsSha512Mechanism()))
+	}
+
+	return opts
+}
+
+// rawLogToRecord keys the log by its pod, so that
+// the logs of a pod stay ordered in one partition.
+func (k *kafka) rawLogToRecord(r backend.RawLog) (*kgo.Record, error) {
+	data := map[string]string{}
+	for name, value := range r.Metadata {
+		data[name] = value
+	}
+	data["watcher"] = "logs"
+
+	topic, err := k.renderTopic(data)
+	if err != nil {
+		return nil, err
+	}
+
+	t := time.Now()
+	if ns, err := strconv.ParseInt(r.Timestamp, 10, 64); err == nil {
+		t = time.Unix(0, ns)
+	}
+
+	var value []byte
+	if k.encoding == EncodingAvro {
+		value, err = avroLog(k.schemaID, t.UnixMilli(), r.Log, r.Metadata)
+	} else {
+		value, err = json.Marshal(logValue{Timestamp: t, Log: r.Log, Labels: r.Metadata})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &kgo.Record{
+		Topic:     topic,
+		Key:       []byte(r.Metadata["namespace"] + "/" + r.Metadata["pod"]),
+		Value:     value,
+		Timestamp: t,
+	}, nil
+}
+
+func (k *kafka) eventToRecord(e backend.Event) (*kgo.Record, error) {
+	data := e.Fields()
+	data["watcher"] = "events"
+
+	topic, err := k.renderTopic(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var value []byte
+	if k.encoding == EncodingAvro {
+		value, err = avroEvent(k.schemaID, e)
+	} else {
+		value, err = json.Marshal(e)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t := e.Timestamp
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	return &kgo.Record{
+		Topic:     topic,
+		Key:       []byte(e.Namespace + "/" + e.Name),
+		Value:     value,
+		Timestamp: t,
+	}, nil
+}
+
+func (k *kafka) renderTopic(data map[string]string) (string, error) {
+	var buf strings.Builder
+	if err := k.topic.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	if buf.Len() == 0 {
+		return "", fmt.Errorf("kafka: empty topic for %v", data)
+	}
+	return buf.String(), nil
+}
+
+// flush produces the batch, then reports the records
+// which could not be delivered, by topic, so that a
+// broken topic doesn't fail the records of others.
+func (k *kafka) flush(client *kgo.Client, batch []*record) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if client == nil {
+		k.errChannel <- fmt.Errorf("kafka: dropped %d records without a client", len(batch))
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(batch))
+	for _, r := range batch {
+		r := r
+		client.Produce(context.Background(), r.Record, func(_ *kgo.Record, err error) {
+			r.err = err
+			wg.Done()
+		})
+	}
+
+	if err := client.Flush(context.Background()); err != nil {
+		k.errChannel <- fmt.Errorf("kafka: %w", err)
+	}
+	wg.Wait()
+
+	topics := []string{}
+	failed := map[string][]*record{}
+	for _, r := range batch {
+		if r.err == nil {
+			continue
+		}
+		if _, ok := failed[r.Topic]; !ok {
+			topics = append(topics, r.Topic)
+		}
+		failed[r.Topic] = append(failed[r.Topic], r)
+	}
+
+	for _, topic := range topics {
+		rs := failed[topic]
+		k.errChannel <- fmt.Errorf("kafka: dropped %d records of %s: %w", len(rs), topic, rs[0].err)
+	}
+}
+
+// Close closes the injected channels. Anything
+// already on the stack will get flushed.
+func (k *kafka) Close() {
+	if k.logChannel != nil {
+		close(k.logChannel)
+	}
+
+	if k.eventChannel != nil {
+		close(k.eventChannel)
+	}
+}
@@ -0,0 +1,284 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+	"github.com/twmb/franz-go/pkg/sr"
+)
+
+func newCluster(t *testing.T, opts ...kfake.Opt) *kfake.Cluster {
+	c, err := kfake.NewCluster(append([]kfake.Opt{kfake.NumBrokers(3), kfake.SeedTopics(3, "admiral.hello")}, opts...)...)
+	assert.Nil(t, err)
+	t.Cleanup(c.Close)
+	return c
+}
+
+func newKafka(c *kfake.Cluster, ch chan backend.RawLog, events chan backend.Event, errCh chan error) *Builder {
+	topic := template.Must(template.New("topic").Parse("admiral.{{.namespace}}"))
+	return New().Brokers(c.ListenAddrs()).Topic(topic).LogChannel(ch).EventChannel(events).ErrChannel(errCh)
+}
+
+// consume reads n records of the topic from the cluster.
+func consume(t *testing.T, c *kfake.Cluster, topic string, n int, opts ...kgo.Opt) []*kgo.Record {
+	client, err := kgo.NewClient(append([]kgo.Opt{
+		kgo.SeedBrokers(c.ListenAddrs()...),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	}, opts...)...)
+	assert.Nil(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	records := []*kgo.Record{}
+	for len(records) < n && ctx.Err() == nil {
+		client.PollFetches(ctx).EachRecord(func(r *kgo.Record) {
+			records = append(records, r)
+		})
+	}
+	return records
+}
+
+func Test_Build(t *testing.T) {
+	ch := make(chan backend.RawLog)
+	events := make(chan backend.Event)
+	errCh := make(chan error)
+	topic := template.Must(template.New("topic").Parse("admiral"))
+
+	k := New().Brokers([]string{"127.0.0.1:9092"}).Topic(topic).LogChannel(ch).EventChannel(events).ErrChannel(errCh).Build()
+
+	assert.Equal(t, []string{"127.0.0.1:9092"}, k.brokers)
+	assert.Equal(t, topic, k.topic)
+	assert.Equal(t, ch, k.logChannel)
+	assert.Equal(t, events, k.eventChannel)
+	assert.Equal(t, errCh, k.errChannel)
+	assert.Equal(t, EncodingJSON, k.encoding)
+	assert.Equal(t, CompressionNone, k.compression)
+	assert.Equal(t, AcksAll, k.acks)
+	assert.Equal(t, DefaultBatchSize, k.batchSize)
+	assert.Equal(t, DefaultFlushInterval, k.flushInterval)
+}
+
+func Test_avro(t *testing.T) {
+	b, err := avroLog(0, 1696118400000, "some log", map[string]string{"pod": "world"})
+	assert.Nil(t, err)
+
+	native, _, err := logCodec.NativeFromSingle(b)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"timestamp": int64(1696118400000),
+		"log":       "some log",
+		"labels":    map[string]interface{}{"pod": "world"},
+	}, native)
+
+	b, err = avroEvent(7, backend.Event{Kind: "Pod", Name: "world", Reason: "BackOff", Timestamp: time.UnixMilli(1696118400000)})
+	assert.Nil(t, err)
+
+	var header sr.ConfluentHeader
+	id, datum, err := header.DecodeID(b)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, id)
+
+	native, _, err = eventCodec.NativeFromBinary(datum)
+	assert.Nil(t, err)
+	assert.Equal(t, "BackOff", native.(map[string]interface{})["reason"])
+	assert.Equal(t, int64(1696118400000), native.(map[string]interface{})["timestamp"])
+}
+
+func Test_topic(t *testing.T) {
+	topic := template.Must(template.New("topic").Parse("{{.watcher}}.{{.namespace}}"))
+	k := New().Topic(topic).Build()
+
+	r, err := k.rawLogToRecord(backend.RawLog{Log: "some log", Metadata: map[string]string{"namespace": "hello", "pod": "world"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "logs.hello", r.Topic)
+
+	r, err = k.eventToRecord(backend.Event{Namespace: "hello", Kind: "Pod", Name: "world", Reason: "BackOff"})
+	assert.Nil(t, err)
+	assert.Equal(t, "events.hello", r.Topic)
+}
+
+func Test_Stream(t *testing.T) {
+	c := newCluster(t)
+
+	ch := make(chan backend.RawLog, 4)
+	events := make(chan backend.Event, 1)
+	errCh := make(chan error, 1)
+
+	k := newKafka(c, ch, events, errCh).Compression(CompressionSnappy).Build()
+
+	for _, pod := range []string{"world", "world", "other", "another"} {
+		ch <- backend.RawLog{Log: "some log", Timestamp: "1696118400000000000", Metadata: map[string]string{"namespace": "hello", "pod": pod}}
+	}
+	events <- backend.Event{Namespace: "hello", Kind: "Pod", Name: "world", Reason: "BackOff", Timestamp: time.Unix(1696118400, 0)}
+	k.Close()
+	k.Stream()
+
+	assert.Empty(t, errCh)
+
+	records := consume(t, c, "admiral.hello", 5)
+	assert.Len(t, records, 5)
+
+	// records of the same pod land in the same partition
+	partitions := map[string]int32{}
+	logs, event := 0, 0
+	for _, r := range records {
+		if p, ok := partitions[string(r.Key)]; ok {
+			assert.Equal(t, p, r.Partition, string(r.Key))
+		}
+		partitions[string(r.Key)] = r.Partition
+
+		value := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal(r.Value, &value))
+
+		if value["reason"] == "BackOff" {
+			event++
+			assert.Equal(t, "hello/world", string(r.Key))
+			continue
+		}
+
+		logs++
+		assert.Equal(t, "some log", value["log"])
+		assert.Equal(t, time.Unix(1696118400, 0).UnixMilli(), r.Timestamp.UnixMilli())
+		assert.Equal(t, "hello/"+value["labels"].(map[string]interface{})["pod"].(string), string(r.Key))
+	}
+	assert.Equal(t, 4, logs)
+	assert.Equal(t, 1, event)
+}
+
+func Test_StreamSASL(t *testing.T) {
+	for _, mechanism := range []string{SASLPlain, SASLScramSHA256} {
+		c := newCluster(t, kfake.EnableSASL(), kfake.Superuser(mechanism, "admiral", "secret"))
+
+		ch := make(chan backend.RawLog, 1)
+		errCh := make(chan error, 1)
+
+		k := newKafka(c, ch, nil, errCh).SASL(mechanism, "admiral", "secret").Encoding(EncodingAvro).Build()
+
+		ch <- backend.RawLog{Log: "some log", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+		k.Close()
+		k.Stream()
+
+		assert.Empty(t, errCh, mechanism)
+
+		auth := kgo.SASL(scram.Auth{User: "admiral", Pass: "secret"}.AsSha256Mechanism())
+		if mechanism == SASLPlain {
+			auth = kgo.SASL(plain.Auth{User: "admiral", Pass: "secret"}.AsMechanism())
+		}
+
+		records := consume(t, c, "admiral.hello", 1, auth)
+		assert.Len(t, records, 1, mechanism)
+		assert.Equal(t, []byte{0xc3, 0x01}, records[0].Value[:2])
+
+		// with the wrong password
+		ch = make(chan backend.RawLog, 1)
+		errCh = make(chan error, 10)
+
+		k = newKafka(c, ch, nil, errCh).SASL(mechanism, "admiral", "invalid").Build()
+		k.backoff = 0
+
+		ch <- backend.RawLog{Log: "some log", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+		k.Close()
+		k.Stream()
+
+		err := <-errCh
+		assert.Contains(t, err.Error(), "kafka: dropped 1 records of admiral.hello", mechanism)
+	}
+}
+
+func Test_StreamRetry(t *testing.T) {
+	c := newCluster(t)
+
+	// fail the first produce request as if the leader moved
+	c.ControlKey(int16(kmsg.Produce), func(req kmsg.Request) (kmsg.Response, error, bool) {
+		return produceError(req, 6), nil, true
+	})
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	k := newKafka(c, ch, nil, errCh).Compression(CompressionZstd).Build()
+	k.backoff = 0
+
+	ch <- backend.RawLog{Log: "some log", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	k.Close()
+	k.Stream()
+
+	assert.Empty(t, errCh)
+	assert.Len(t, consume(t, c, "admiral.hello", 1), 1)
+}
+
+func Test_StreamErr(t *testing.T) {
+	c := newCluster(t)
+
+	c.ControlKey(int16(kmsg.Produce), func(req kmsg.Request) (kmsg.Response, error, bool) {
+		return produceError(req, 10), nil, true
+	})
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	k := newKafka(c, ch, nil, errCh).Build()
+	k.backoff = 0
+
+	ch <- backend.RawLog{Log: "some log", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	k.Close()
+	k.Stream()
+
+	err := <-errCh
+	assert.Contains(t, err.Error(), "kafka: dropped 1 records of admiral.hello: MESSAGE_TOO_LARGE")
+}
+
+func Test_StreamUnknownTopic(t *testing.T) {
+	c := newCluster(t)
+
+	ch := make(chan backend.RawLog, 3)
+	errCh := make(chan error, 2)
+
+	k := newKafka(c, ch, nil, errCh).Build()
+	k.backoff = 0
+
+	ch <- backend.RawLog{Log: "first", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	ch <- backend.RawLog{Log: "lost", Metadata: map[string]string{"namespace": "missing", "pod": "world"}}
+	ch <- backend.RawLog{Log: "second", Metadata: map[string]string{"namespace": "hello", "pod": "other"}}
+	k.Close()
+	k.Stream()
+
+	// only the records of the missing topic are dropped
+	assert.Len(t, errCh, 1)
+	err := <-errCh
+	assert.Contains(t, err.Error(), "kafka: dropped 1 records of admiral.missing")
+	assert.Contains(t, err.Error(), "UNKNOWN_TOPIC_OR_PARTITION")
+	assert.Len(t, consume(t, c, "admiral.hello", 2), 2)
+}
+
+// produceError fails every partition of the produce request with the code.
+func produceError(req kmsg.Request, code int16) kmsg.Response {
+	produce := req.(*kmsg.ProduceRequest)
+	res := produce.ResponseKind().(*kmsg.ProduceResponse)
+
+	for _, topic := range produce.Topics {
+		rt := kmsg.NewProduceResponseTopic()
+		rt.Topic = topic.Topic
+		for _, partition := range topic.Partitions {
+			rp := kmsg.NewProduceResponseTopicPartition()
+			rp.Partition = partition.Partition
+			rp.ErrorCode = code
+			rt.Partitions = append(rt.Partitions, rp)
+		}
+		res.Topics = append(res.Topics, rt)
+	}
+	return res
+}
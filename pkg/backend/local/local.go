@@ -1,68 +1,301 @@
 package local
 
 import (
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/phil-inc/admiral/pkg/backend"
 )
 
+const (
+	FormatText   = "text"
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+// colors are the ANSI colors prefixes are picked
+// from, leaving out red which flags warnings.
+var colors = []int{32, 33, 34, 35, 36, 92, 93, 94, 95, 96}
+
+const colorWarning = 31
+
 type Builder struct {
 	logChannel   chan backend.RawLog
-	eventChannel chan string
+	eventChannel chan backend.Event
 	errChannel   chan error
+	format       string
+	output       io.Writer
+	color        bool
 }
 
+// New returns a builder for the local struct.
 func New() *Builder {
 	return &Builder{}
 }
 
+// Build returns a configured local struct.
 func (b *Builder) Build() *local {
-	return &local{
+	l := &local{
 		logChannel:   b.logChannel,
 		eventChannel: b.eventChannel,
 		errChannel:   b.errChannel,
+		format:       b.format,
+		output:       b.output,
+		color:        b.color,
+		done:         make(chan struct{}),
 	}
+
+	if l.format == "" {
+		l.format = FormatText
+	}
+	if l.output == nil {
+		l.output = os.Stdout
+	}
+
+	return l
 }
 
+// LogChannel sets the channel from where
+// local will take logs.
 func (b *Builder) LogChannel(l chan backend.RawLog) *Builder {
 	b.logChannel = l
 	return b
 }
 
+// ErrChannel sets the channel where local
+// will send its errors.
 func (b *Builder) ErrChannel(e chan error) *Builder {
 	b.errChannel = e
 	return b
 }
 
-func (b *Builder) EventChannel(e chan string) *Builder {
+// EventChannel sets the channel from where
+// local will take events.
+func (b *Builder) EventChannel(e chan backend.Event) *Builder {
 	b.eventChannel = e
 	return b
 }
 
+// Format sets how logs and events are printed:
+// FormatText (default), FormatJSON or FormatLogfmt.
+func (b *Builder) Format(format string) *Builder {
+	b.format = format
+	return b
+}
+
+// Output sets where logs and events
+// are printed, defaulting to stdout.
+func (b *Builder) Output(output io.Writer) *Builder {
+	b.output = output
+	return b
+}
+
+// Color colors the prefix of FormatText
+// lines with a color picked per pod.
+func (b *Builder) Color(color bool) *Builder {
+	b.color = color
+	return b
+}
+
 type local struct {
 	logChannel   chan backend.RawLog
 	errChannel   chan error
-	eventChannel chan string
+	eventChannel chan backend.Event
+	format       string
+	output       io.Writer
+	color        bool
+	mutex        sync.Mutex
+	done         chan struct{}
+	closeOnce    sync.Once
+}
+
+type logRecord struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Log       string            `json:"log"`
+	Labels    map[string]string `json:"labels,omitempty"`
 }
 
+// Stream prints whatever is received on logChannel
+// and eventChannel until local is closed.
 func (l *local) Stream() {
-	go l.streamLogs()
-	go l.streamEvents()
+	var wg sync.WaitGroup
+
+	if l.logChannel != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.streamLogs()
+		}()
+	}
+
+	if l.eventChannel != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.streamEvents()
+		}()
+	}
+
+	wg.Wait()
 }
 
 func (l *local) streamLogs() {
-	for raw := range l.logChannel {
-		// fmt.Println(raw.Log)
-		fmt.Println(raw.Metadata)
+	for {
+		select {
+		case raw, ok := <-l.logChannel:
+			if !ok {
+				return
+			}
+			l.print(l.formatLog(raw))
+
+		case <-l.done:
+			return
+		}
 	}
 }
 
 func (l *local) streamEvents() {
-	for event := range l.eventChannel {
-		fmt.Println(event)
+	for {
+		select {
+		case event, ok := <-l.eventChannel:
+			if !ok {
+				return
+			}
+			l.print(l.formatEvent(event))
+
+		case <-l.done:
+			return
+		}
+	}
+}
+
+func (l *local) print(line string, err error) {
+	if err != nil {
+		l.errChannel <- err
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, err := fmt.Fprintln(l.output, line); err != nil {
+		l.errChannel <- err
+	}
+}
+
+func (l *local) formatLog(r backend.RawLog) (string, error) {
+	t := time.Now()
+	if ns, err := strconv.ParseInt(r.Timestamp, 10, 64); err == nil {
+		t = time.Unix(0, ns)
+	}
+
+	switch l.format {
+	case FormatJSON:
+		b, err := json.Marshal(logRecord{Timestamp: t, Log: r.Log, Labels: r.Metadata})
+		return string(b), err
+
+	case FormatLogfmt:
+		fields := [][2]string{{"time", t.Format(time.RFC3339Nano)}}
+		for _, k := range sortedKeys(r.Metadata) {
+			fields = append(fields, [2]string{k, r.Metadata[k]})
+		}
+		fields = append(fields, [2]string{"msg", r.Log})
+		return logfmt(fields), nil
+	}
+
+	prefix := []string{}
+	for _, k := range []string{"namespace", "pod", "container"} {
+		if v := r.Metadata[k]; v != "" {
+			prefix = append(prefix, v)
+		}
+	}
+
+	return l.colorize(strings.Join(prefix, "/"), colorOf(r.Metadata["pod"])) + " " + r.Log, nil
+}
+
+func (l *local) formatEvent(e backend.Event) (string, error) {
+	switch l.format {
+	case FormatJSON:
+		b, err := json.Marshal(e)
+		return string(b), err
+
+	case FormatLogfmt:
+		return logfmt([][2]string{
+			{"time", e.Timestamp.Format(time.RFC3339Nano)},
+			{"cluster", e.Cluster},
+			{"namespace", e.Namespace},
+			{"kind", e.Kind},
+			{"object", e.Name},
+			{"reason", e.Reason},
+			{"type", e.Type},
+			{"msg", e.Message},
+		}), nil
+	}
+
+	prefix := []string{}
+	for _, v := range []string{e.Namespace, strings.ToLower(e.Kind), e.Name} {
+		if v != "" {
+			prefix = append(prefix, v)
+		}
+	}
+
+	color := colorOf(e.Name)
+	if e.IsWarning() {
+		color = colorWarning
+	}
+
+	return l.colorize(strings.Join(prefix, "/"), color) + " " + e.Reason + ": " + e.Message, nil
+}
+
+func (l *local) colorize(s string, color int) string {
+	if !l.color {
+		return s
+	}
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, s)
+}
+
+// colorOf picks the same color for a pod every time.
+func colorOf(name string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return colors[h.Sum32()%uint32(len(colors))]
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// logfmt joins the fields as key=value pairs,
+// quoting the values which need it.
+func logfmt(fields [][2]string) string {
+	pairs := make([]string, 0, len(fields))
+	for _, f := range fields {
+		v := f[1]
+		if v == "" || strings.ContainsAny(v, " =\"\\\n\t") {
+			v = strconv.Quote(v)
+		}
+		pairs = append(pairs, f[0]+"="+v)
 	}
+	return strings.Join(pairs, " ")
 }
 
+// Close stops printing. The channels are left
+// open, as they are shared with other backends.
 func (l *local) Close() {
-	close(l.logChannel)
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
 }
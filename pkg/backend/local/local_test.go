@@ -0,0 +1,112 @@
+package local
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Build(t *testing.T) {
+	ch := make(chan backend.RawLog)
+	events := make(chan backend.Event)
+	errCh := make(chan error)
+
+	l := New().LogChannel(ch).EventChannel(events).ErrChannel(errCh).Build()
+
+	assert.Equal(t, ch, l.logChannel)
+	assert.Equal(t, events, l.eventChannel)
+	assert.Equal(t, errCh, l.errChannel)
+	assert.Equal(t, FormatText, l.format)
+	assert.Equal(t, os.Stdout, l.output)
+	assert.False(t, l.color)
+}
+
+func Test_formatLog(t *testing.T) {
+	r := backend.RawLog{
+		Log:       `some "quoted" log`,
+		Timestamp: "1696118400123456789",
+		Metadata:  map[string]string{"namespace": "hello", "pod": "world", "container": "app"},
+	}
+
+	line, err := New().Build().formatLog(r)
+	assert.Nil(t, err)
+	assert.Equal(t, `hello/world/app some "quoted" log`, line)
+
+	line, err = New().Color(true).Build().formatLog(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "\x1b["+strconv.Itoa(colorOf("world"))+`mhello/world/app`+"\x1b[0m"+` some "quoted" log`, line)
+
+	timestamp := time.Unix(0, 1696118400123456789)
+
+	line, err = New().Format(FormatJSON).Build().formatLog(r)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"timestamp":"`+timestamp.Format(time.RFC3339Nano)+`","log":"some \"quoted\" log","labels":{"container":"app","namespace":"hello","pod":"world"}}`, line)
+
+	line, err = New().Format(FormatLogfmt).Build().formatLog(r)
+	assert.Nil(t, err)
+	assert.Equal(t, `time=`+timestamp.Format(time.RFC3339Nano)+` container=app namespace=hello pod=world msg="some \"quoted\" log"`, line)
+}
+
+func Test_formatEvent(t *testing.T) {
+	e := backend.Event{
+		Cluster:   "prod",
+		Namespace: "hello",
+		Kind:      "Pod",
+		Name:      "world",
+		Reason:    "BackOff",
+		Type:      "Warning",
+		Message:   "Back-off restarting failed container",
+		Timestamp: time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	line, err := New().Build().formatEvent(e)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello/pod/world BackOff: Back-off restarting failed container", line)
+
+	line, err = New().Color(true).Build().formatEvent(e)
+	assert.Nil(t, err)
+	assert.Equal(t, "\x1b[31mhello/pod/world\x1b[0m BackOff: Back-off restarting failed container", line)
+
+	line, err = New().Format(FormatLogfmt).Build().formatEvent(e)
+	assert.Nil(t, err)
+	assert.Equal(t, `time=2023-10-01T00:00:00Z cluster=prod namespace=hello kind=Pod object=world reason=BackOff type=Warning msg="Back-off restarting failed container"`, line)
+
+	line, err = New().Format(FormatJSON).Build().formatEvent(e)
+	assert.Nil(t, err)
+	assert.Contains(t, line, `"reason":"BackOff"`)
+}
+
+func Test_Stream(t *testing.T) {
+	ch := make(chan backend.RawLog, 1)
+	events := make(chan backend.Event, 1)
+	errCh := make(chan error, 1)
+	var out bytes.Buffer
+
+	l := New().LogChannel(ch).EventChannel(events).ErrChannel(errCh).Output(&out).Build()
+
+	ch <- backend.RawLog{Log: "some log", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	events <- backend.Event{Namespace: "hello", Kind: "Pod", Name: "world", Reason: "Started", Message: "some event"}
+
+	done := make(chan struct{})
+	go func() {
+		l.Stream()
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return len(ch) == 0 && len(events) == 0 }, time.Second, time.Millisecond)
+	l.Close()
+	<-done
+
+	assert.Contains(t, out.String(), "hello/world some log\n")
+	assert.Contains(t, out.String(), "hello/pod/world Started: some event\n")
+	assert.Empty(t, errCh)
+
+	// the shared channels are left open
+	ch <- backend.RawLog{}
+	events <- backend.Event{}
+}
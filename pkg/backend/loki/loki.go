@@ -1,34 +1,89 @@
 package loki
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/http"
-	"sync"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
+	"github.com/golang/snappy"
 	"github.com/phil-inc/admiral/pkg/backend"
 	"github.com/phil-inc/admiral/pkg/utils"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// EncodingJSON pushes streams as JSON.
+	EncodingJSON = "json"
+	// EncodingProtobuf pushes streams as a snappy
+	// compressed logproto.PushRequest, like Promtail.
+	EncodingProtobuf = "protobuf"
+
+	// DefaultBatchSize pushes every entry on its own.
+	DefaultBatchSize     = 1
+	DefaultFlushInterval = time.Second
 )
 
 type Builder struct {
-	url        string
-	client     *http.Client
-	logChannel chan backend.RawLog
-	errChannel chan error
+	url           string
+	client        *http.Client
+	logChannel    chan backend.RawLog
+	eventChannel  chan backend.Event
+	errChannel    chan error
+	tenant        *template.Template
+	headers       map[string]string
+	batchSize     int
+	flushInterval time.Duration
+	encoding      string
+	metadata      []string
+	rules         []rule
+	allow         []string
+	deny          []string
 }
 
 // New returns a Builder for the Loki struct.
 func New() *Builder {
-	return &Builder{}
+	return &Builder{headers: map[string]string{}}
 }
 
 // Build returns a configured Loki struct.
 func (b *Builder) Build() *loki {
-	return &loki{
-		url:        b.url,
-		client:     b.client,
-		logChannel: b.logChannel,
-		errChannel: b.errChannel,
+	l := &loki{
+		url:           b.url,
+		client:        b.client,
+		logChannel:    b.logChannel,
+		eventChannel:  b.eventChannel,
+		errChannel:    b.errChannel,
+		tenant:        b.tenant,
+		headers:       b.headers,
+		batchSize:     b.batchSize,
+		flushInterval: b.flushInterval,
+		encoding:      b.encoding,
+		metadata:      b.metadata,
+		rules:         b.rules,
+		allow:         b.allow,
+		deny:          b.deny,
+	}
+
+	if l.encoding == "" {
+		l.encoding = EncodingJSON
 	}
+	if l.batchSize <= 0 {
+		l.batchSize = DefaultBatchSize
+	}
+	if l.flushInterval <= 0 {
+		l.flushInterval = DefaultFlushInterval
+	}
+
+	return l
 }
 
 // Url takes the hostname of the Loki instance
@@ -51,6 +106,13 @@ func (b *Builder) LogChannel(l chan backend.RawLog) *Builder {
 	return b
 }
 
+// EventChannel injects a channel receiving cluster
+// events that will end up going to Loki in Stream().
+func (b *Builder) EventChannel(e chan backend.Event) *Builder {
+	b.eventChannel = e
+	return b
+}
+
 // ErrChannel injects a channel aggregating errors
 // from Stream().
 func (b *Builder) ErrChannel(e chan error) *Builder {
@@ -58,37 +120,223 @@ func (b *Builder) ErrChannel(e chan error) *Builder {
 	return b
 }
 
+// Tenant sets the template rendering the X-Scope-OrgID
+// of a log from its labels, or of an event from its
+// fields. A template without actions is a static tenant,
+// and entries rendering an empty one are pushed without.
+func (b *Builder) Tenant(tenant *template.Template) *Builder {
+	b.tenant = tenant
+	return b
+}
+
+// BasicAuth authenticates pushes with the
+// username and password, such as for a gateway.
+func (b *Builder) BasicAuth(username, password string) *Builder {
+	b.headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	return b
+}
+
+// BearerToken authenticates pushes with the token.
+func (b *Builder) BearerToken(token string) *Builder {
+	b.headers["Authorization"] = "Bearer " + token
+	return b
+}
+
+// Header adds a header to every push.
+func (b *Builder) Header(name, value string) *Builder {
+	b.headers[name] = value
+	return b
+}
+
+// Batch sets how many entries are pushed at most
+// in a request, and how long they are buffered.
+func (b *Builder) Batch(size int, interval time.Duration) *Builder {
+	b.batchSize = size
+	b.flushInterval = interval
+	return b
+}
+
+// Encoding sets how streams are pushed:
+// EncodingJSON (default) or EncodingProtobuf.
+func (b *Builder) Encoding(encoding string) *Builder {
+	b.encoding = encoding
+	return b
+}
+
+// StructuredMetadata sets the labels sent as the
+// structured metadata of entries, rather than as
+// stream labels, such as high-cardinality trace
+// ids. It needs Loki 3 or later.
+func (b *Builder) StructuredMetadata(labels ...string) *Builder {
+	b.metadata = append(b.metadata, labels...)
+	return b
+}
+
+// Relabel adds a rule rewriting the labels of
+// entries in the style of Prometheus relabel_configs,
+// run in order before the structured metadata and
+// allowed labels are picked. The regex must be
+// anchored, and an empty separator or nil regex take
+// the Prometheus defaults. The replacement is used as
+// is, so that an empty one clears the target label;
+// DefaultReplacement is the Prometheus default.
+func (b *Builder) Relabel(action string, sourceLabels []string, separator string, regex *regexp.Regexp, targetLabel string, replacement string) *Builder {
+	if separator == "" {
+		separator = DefaultSeparator
+	}
+	if regex == nil {
+		regex = defaultRegex
+	}
+	b.rules = append(b.rules, rule{
+		action:       action,
+		sourceLabels: sourceLabels,
+		separator:    separator,
+		regex:        regex,
+		targetLabel:  targetLabel,
+		replacement:  replacement,
+	})
+	return b
+}
+
+// AllowLabels sets the only labels kept as stream
+// labels, when any, named like DenyLabels.
+func (b *Builder) AllowLabels(labels ...string) *Builder {
+	b.allow = append(b.allow, labels...)
+	return b
+}
+
+// DenyLabels sets labels never kept as stream labels,
+// named with "_" in place of ".", "-" and "/" like the
+// labels of logs are, such as pod_template_hash.
+func (b *Builder) DenyLabels(labels ...string) *Builder {
+	b.deny = append(b.deny, labels...)
+	return b
+}
+
 type loki struct {
-	url        string
-	client     *http.Client
-	logChannel chan backend.RawLog
-	errChannel chan error
-	open       chan bool
-	mutex      sync.RWMutex
+	url           string
+	client        *http.Client
+	logChannel    chan backend.RawLog
+	eventChannel  chan backend.Event
+	errChannel    chan error
+	tenant        *template.Template
+	headers       map[string]string
+	batchSize     int
+	flushInterval time.Duration
+	encoding      string
+	metadata      []string
+	rules         []rule
+	allow         []string
+	deny          []string
 }
 
 type lokiDTO struct {
 	Streams []streams `json:"streams"`
 }
 
+// streams holds the values of a stream, with the
+// structured metadata of each value in Metadata
+// when any of them has some.
 type streams struct {
-	Stream map[string]string `json:"stream"`
-	Values [][]string        `json:"values"`
+	Stream   map[string]string
+	Values   [][]string
+	Metadata []map[string]string
+}
+
+// MarshalJSON lays the structured metadata
+// out as the third element of its value.
+func (s streams) MarshalJSON() ([]byte, error) {
+	values := make([][]interface{}, len(s.Values))
+	for i, v := range s.Values {
+		values[i] = []interface{}{v[0], v[1]}
+		if i < len(s.Metadata) && len(s.Metadata[i]) > 0 {
+			values[i] = append(values[i], s.Metadata[i])
+		}
+	}
+
+	return json.Marshal(struct {
+		Stream map[string]string `json:"stream"`
+		Values [][]interface{}   `json:"values"`
+	}{s.Stream, values})
 }
 
-// Stream does a POST request of the logChannel
-// into the Loki API.
+// batch holds the entries of a tenant,
+// grouped in streams by their labels.
+type batch struct {
+	streams map[string]*streams
+	size    int
+}
+
+// Stream batches the logChannel and the eventChannel
+// by tenant, and does a POST request of each batch
+// into the Loki API once it is full, at every flush
+// interval, and when both channels are closed.
 func (l *loki) Stream() {
-	for raw := range l.logChannel {
-		l.mutex.Lock()
-		dto := l.rawLogToDTO(raw)
-		l.mutex.Unlock()
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+
+	batches := map[string]*batch{}
 
-		err := utils.Send(dto, "POST", l.url, l.client)
+	add := func(tenant string, dto *lokiDTO, err error) {
 		if err != nil {
 			l.errChannel <- err
+			return
+		}
+
+		b, ok := batches[tenant]
+		if !ok {
+			b = &batch{streams: map[string]*streams{}}
+			batches[tenant] = b
+		}
+		b.add(dto)
+
+		if b.size >= l.batchSize {
+			l.push(tenant, b)
+			delete(batches, tenant)
+		}
+	}
+
+	flush := func() {
+		for tenant, b := range batches {
+			l.push(tenant, b)
 		}
+		batches = map[string]*batch{}
 	}
+
+	logChannel, eventChannel := l.logChannel, l.eventChannel
+
+	for logChannel != nil || eventChannel != nil {
+		select {
+		case raw, ok := <-logChannel:
+			if !ok {
+				logChannel = nil
+				continue
+			}
+			dto := l.relabel(l.rawLogToDTO(raw))
+			if dto == nil {
+				continue
+			}
+			tenant, err := l.renderTenant(raw.Metadata)
+			add(tenant, l.structure(dto), err)
+
+		case event, ok := <-eventChannel:
+			if !ok {
+				eventChannel = nil
+				continue
+			}
+			dto := l.relabel(eventToDTO(event))
+			if dto == nil {
+				continue
+			}
+			tenant, err := l.renderTenant(event.Fields())
+			add(tenant, l.structure(dto), err)
+
+		case <-ticker.C:
+			flush()
+		}
+	}
+
+	flush()
 }
 
 func (l *loki) rawLogToDTO(r backend.RawLog) *lokiDTO {
@@ -102,8 +350,264 @@ func (l *loki) rawLogToDTO(r backend.RawLog) *lokiDTO {
 	}
 }
 
-// Close will close the injected logChannel.
+// eventToDTO labels the event so it can be queried
+// alongside the pod logs of the same cluster and namespace.
+func eventToDTO(e backend.Event) *lokiDTO {
+	labels := map[string]string{
+		"cluster":   e.Cluster,
+		"namespace": e.Namespace,
+		"reason":    e.Reason,
+		"type":      e.Type,
+		"kind":      e.Kind,
+	}
+
+	// Loki rejects streams with empty label values
+	for k, v := range labels {
+		if v == "" {
+			delete(labels, k)
+		}
+	}
+
+	return &lokiDTO{
+		Streams: []streams{
+			{
+				Stream: labels,
+				Values: [][]string{{
+					fmt.Sprintf("%d", e.Timestamp.UnixNano()),
+					fmt.Sprintf("%s/%s: %s", strings.ToLower(e.Kind), e.Name, e.Message),
+				}},
+			},
+		},
+	}
+}
+
+// structure moves the structured
+// metadata labels out of the streams.
+func (l *loki) structure(dto *lokiDTO) *lokiDTO {
+	if len(l.metadata) == 0 {
+		return dto
+	}
+
+	for i, s := range dto.Streams {
+		labels := map[string]string{}
+		metadata := map[string]string{}
+		for k, v := range s.Stream {
+			if slices.Contains(l.metadata, k) {
+				metadata[k] = v
+			} else {
+				labels[k] = v
+			}
+		}
+
+		dto.Streams[i].Stream = labels
+		if len(metadata) > 0 {
+			dto.Streams[i].Metadata = make([]map[string]string, len(s.Values))
+			for j := range s.Values {
+				dto.Streams[i].Metadata[j] = metadata
+			}
+		}
+	}
+	return dto
+}
+
+func (l *loki) renderTenant(data map[string]string) (string, error) {
+	if l.tenant == nil {
+		return "", nil
+	}
+
+	var buf strings.Builder
+	if err := l.tenant.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// add appends the values of the dto to
+// the streams having the same labels.
+func (b *batch) add(dto *lokiDTO) {
+	for _, s := range dto.Streams {
+		key := streamKey(s.Stream)
+		if existing, ok := b.streams[key]; ok {
+			if existing.Metadata != nil || s.Metadata != nil {
+				existing.Metadata = append(pad(existing.Metadata, len(existing.Values)), pad(s.Metadata, len(s.Values))...)
+			}
+			existing.Values = append(existing.Values, s.Values...)
+		} else {
+			b.streams[key] = &streams{Stream: s.Stream, Values: s.Values, Metadata: s.Metadata}
+		}
+		b.size += len(s.Values)
+	}
+}
+
+// pad keeps the metadata aligned with
+// values which have none.
+func pad(metadata []map[string]string, n int) []map[string]string {
+	for len(metadata) < n {
+		metadata = append(metadata, nil)
+	}
+	return metadata
+}
+
+func (b *batch) dto() *lokiDTO {
+	keys := make([]string, 0, len(b.streams))
+	for k := range b.streams {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	dto := &lokiDTO{}
+	for _, k := range keys {
+		dto.Streams = append(dto.Streams, *b.streams[k])
+	}
+	return dto
+}
+
+// streamKey identifies a stream by its sorted labels.
+func streamKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var key strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&key, "%s=%q,", k, labels[k])
+	}
+	return key.String()
+}
+
+func (l *loki) push(tenant string, b *batch) {
+	headers := make(map[string]string, len(l.headers)+1)
+	for k, v := range l.headers {
+		headers[k] = v
+	}
+	if tenant != "" {
+		headers["X-Scope-OrgID"] = tenant
+	}
+
+	var err error
+	if l.encoding == EncodingProtobuf {
+		err = l.sendProto(b.dto(), headers)
+	} else {
+		err = utils.SendWithHeaders(b.dto(), "POST", l.url, headers, l.client)
+	}
+	if err != nil {
+		l.errChannel <- err
+	}
+}
+
+func (l *loki) sendProto(dto *lokiDTO, headers map[string]string) error {
+	body, err := dto.marshalProto()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", l.url, bytes.NewReader(snappy.Encode(nil, body)))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	_, err = utils.Do(req, l.client)
+	return err
+}
+
+// marshalProto encodes the dto as a logproto.PushRequest.
+func (dto *lokiDTO) marshalProto() ([]byte, error) {
+	var b []byte
+	for _, s := range dto.Streams {
+		stream, err := s.marshalProto()
+		if err != nil {
+			return nil, err
+		}
+		b = appendMessage(b, 1, stream)
+	}
+	return b, nil
+}
+
+// marshalProto encodes the stream as a logproto.StreamAdapter,
+// whose labels are in the Prometheus format.
+func (s streams) marshalProto() ([]byte, error) {
+	names := make([]string, 0, len(s.Stream))
+	for k := range s.Stream {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, k := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", k, s.Stream[k])
+	}
+
+	b := appendString(nil, 1, "{"+strings.Join(pairs, ", ")+"}")
+
+	for i, v := range s.Values {
+		ns, err := strconv.ParseInt(v[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("loki: invalid timestamp %q: %w", v[0], err)
+		}
+
+		var timestamp []byte
+		if sec := ns / int64(time.Second); sec != 0 {
+			timestamp = protowire.AppendTag(timestamp, 1, protowire.VarintType)
+			timestamp = protowire.AppendVarint(timestamp, uint64(sec))
+		}
+		if nanos := ns % int64(time.Second); nanos != 0 {
+			timestamp = protowire.AppendTag(timestamp, 2, protowire.VarintType)
+			timestamp = protowire.AppendVarint(timestamp, uint64(nanos))
+		}
+
+		entry := appendMessage(nil, 1, timestamp)
+		entry = appendString(entry, 2, v[1])
+
+		if i < len(s.Metadata) {
+			keys := make([]string, 0, len(s.Metadata[i]))
+			for k := range s.Metadata[i] {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				pair := appendString(nil, 1, k)
+				pair = appendString(pair, 2, s.Metadata[i][k])
+				entry = appendMessage(entry, 3, pair)
+			}
+		}
+
+		b = appendMessage(b, 2, entry)
+	}
+	return b, nil
+}
+
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+// appendString skips empty strings,
+// as they are the proto3 default.
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// Close will close the injected channels.
 // Unprocessed items will still get streamed.
 func (l *loki) Close() {
-	close(l.logChannel)
+	if l.logChannel != nil {
+		close(l.logChannel)
+	}
+
+	if l.eventChannel != nil {
+		close(l.eventChannel)
+	}
 }
@@ -1,15 +1,22 @@
 package loki
 
 import (
+	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"sync"
 	"testing"
+	"text/template"
+	"time"
 
+	"github.com/golang/snappy"
 	"github.com/phil-inc/admiral/pkg/backend"
 	"github.com/phil-inc/admiral/pkg/utils"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
 func Test_Build(t *testing.T) {
@@ -49,6 +56,58 @@ func Test_rawLogToDTO(t *testing.T) {
 
 }
 
+func Test_eventToDTO(t *testing.T) {
+	e := backend.Event{
+		Cluster:   "hello-cluster",
+		Namespace: "hello-namespace",
+		Kind:      "Node",
+		Name:      "hello-node",
+		Reason:    "NodeNotReady",
+		Type:      "Warning",
+		Message:   "Node is not ready",
+		Timestamp: time.Unix(0, 1696118400000000000),
+	}
+
+	actual := eventToDTO(e)
+
+	assert.Equal(t, map[string]string{
+		"cluster":   "hello-cluster",
+		"namespace": "hello-namespace",
+		"reason":    "NodeNotReady",
+		"type":      "Warning",
+		"kind":      "Node",
+	}, actual.Streams[0].Stream)
+	assert.Equal(t, []string{"1696118400000000000", "node/hello-node: Node is not ready"}, actual.Streams[0].Values[0])
+
+	e.Namespace = ""
+	actual = eventToDTO(e)
+	assert.NotContains(t, actual.Streams[0].Stream, "namespace")
+}
+
+func Test_StreamEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		b, err := ioutil.ReadAll(r.Body)
+
+		assert.Nil(t, err)
+		assert.Contains(t, string(b), "NodeNotReady")
+		assert.Contains(t, string(b), "some event")
+	}))
+
+	cli := &http.Client{}
+	ch := make(chan backend.Event)
+	errCh := make(chan error)
+
+	l := New().ErrChannel(errCh).Url(server.URL).Client(cli).EventChannel(ch).Build()
+
+	go l.Stream()
+
+	l.eventChannel <- backend.Event{Reason: "NodeNotReady", Message: "some event"}
+
+	l.Close()
+}
+
 func Test_Concurrency(t *testing.T) {
 	received := 0
 
@@ -165,3 +224,298 @@ func Test_sendRequestRespErr(t *testing.T) {
 
 	l.Close()
 }
+
+func Test_batch(t *testing.T) {
+	b := &batch{streams: map[string]*streams{}}
+	b.add(&lokiDTO{Streams: []streams{{Stream: map[string]string{"app": "b"}, Values: [][]string{{"1", "one"}}}}})
+	b.add(&lokiDTO{Streams: []streams{{Stream: map[string]string{"app": "a"}, Values: [][]string{{"2", "two"}}}}})
+	b.add(&lokiDTO{Streams: []streams{{Stream: map[string]string{"app": "b"}, Values: [][]string{{"3", "three"}}}}})
+
+	assert.Equal(t, 3, b.size)
+	assert.Equal(t, &lokiDTO{Streams: []streams{
+		{Stream: map[string]string{"app": "a"}, Values: [][]string{{"2", "two"}}},
+		{Stream: map[string]string{"app": "b"}, Values: [][]string{{"1", "one"}, {"3", "three"}}},
+	}}, b.dto())
+}
+
+func Test_StreamTenants(t *testing.T) {
+	var mutex sync.Mutex
+	pushes := map[string][]lokiDTO{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Basic YWRtaXJhbDpzZWNyZXQ=", r.Header.Get("Authorization"))
+		assert.Equal(t, "platform", r.Header.Get("X-Team"))
+
+		dto := lokiDTO{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&dto))
+
+		mutex.Lock()
+		tenant := r.Header.Get("X-Scope-OrgID")
+		pushes[tenant] = append(pushes[tenant], dto)
+		mutex.Unlock()
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tenant := template.Must(template.New("tenant").Parse(`{{if eq .namespace "payments"}}payments{{end}}`))
+
+	ch := make(chan backend.RawLog, 3)
+	eventCh := make(chan backend.Event, 1)
+	errCh := make(chan error, 1)
+
+	l := New().
+		Url(server.URL).
+		Client(&http.Client{}).
+		Tenant(tenant).
+		BasicAuth("admiral", "secret").
+		Header("X-Team", "platform").
+		Batch(100, time.Hour).
+		LogChannel(ch).
+		EventChannel(eventCh).
+		ErrChannel(errCh).
+		Build()
+
+	ch <- backend.RawLog{Log: "charged", Timestamp: "1", Metadata: map[string]string{"namespace": "payments", "pod": "api"}}
+	ch <- backend.RawLog{Log: "started", Timestamp: "2", Metadata: map[string]string{"namespace": "default", "pod": "web"}}
+	ch <- backend.RawLog{Log: "refunded", Timestamp: "3", Metadata: map[string]string{"namespace": "payments", "pod": "api"}}
+	eventCh <- backend.Event{Namespace: "payments", Kind: "Pod", Name: "api", Reason: "Killing", Message: "Stopping container", Timestamp: time.Unix(4, 0)}
+
+	l.Close()
+	l.Stream()
+
+	assert.Empty(t, errCh)
+	assert.Equal(t, map[string][]lokiDTO{
+		"": {{Streams: []streams{
+			{Stream: map[string]string{"namespace": "default", "pod": "web"}, Values: [][]string{{"2", "started"}}},
+		}}},
+		"payments": {{Streams: []streams{
+			{Stream: map[string]string{"kind": "Pod", "namespace": "payments", "reason": "Killing"}, Values: [][]string{{"4000000000", "pod/api: Stopping container"}}},
+			{Stream: map[string]string{"namespace": "payments", "pod": "api"}, Values: [][]string{{"1", "charged"}, {"3", "refunded"}}},
+		}}},
+	}, pushes)
+}
+
+func Test_StreamBearerToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer glc_token", r.Header.Get("Authorization"))
+		assert.Equal(t, "tenant-1", r.Header.Get("X-Scope-OrgID"))
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("invalid token"))
+	}))
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	l := New().
+		Url(server.URL).
+		Client(&http.Client{}).
+		Tenant(template.Must(template.New("tenant").Parse("tenant-1"))).
+		BearerToken("glc_token").
+		LogChannel(ch).
+		ErrChannel(errCh).
+		Build()
+
+	ch <- backend.RawLog{Log: "some log", Timestamp: "1", Metadata: map[string]string{"pod": "api"}}
+	l.Close()
+	l.Stream()
+
+	err := <-errCh
+	assert.Contains(t, err.Error(), "invalid token")
+}
+
+// fields returns the bytes fields of b numbered num.
+func fields(t *testing.T, b []byte, num protowire.Number) [][]byte {
+	found := [][]byte{}
+	for len(b) > 0 {
+		n, typ, l := protowire.ConsumeTag(b)
+		assert.GreaterOrEqual(t, l, 0)
+		b = b[l:]
+
+		if typ == protowire.BytesType {
+			v, l := protowire.ConsumeBytes(b)
+			if n == num {
+				found = append(found, v)
+			}
+			b = b[l:]
+			continue
+		}
+		l = protowire.ConsumeFieldValue(n, typ, b)
+		assert.GreaterOrEqual(t, l, 0)
+		b = b[l:]
+	}
+	return found
+}
+
+func Test_structure(t *testing.T) {
+	l := New().StructuredMetadata("trace_id").Build()
+
+	dto := l.structure(l.rawLogToDTO(backend.RawLog{
+		Log:       "charged",
+		Timestamp: "1",
+		Metadata:  map[string]string{"app": "payments", "trace_id": "4bf92f35"},
+	}))
+	assert.Equal(t, map[string]string{"app": "payments"}, dto.Streams[0].Stream)
+	assert.Equal(t, []map[string]string{{"trace_id": "4bf92f35"}}, dto.Streams[0].Metadata)
+
+	b := &batch{streams: map[string]*streams{}}
+	b.add(l.structure(l.rawLogToDTO(backend.RawLog{Log: "started", Timestamp: "0", Metadata: map[string]string{"app": "payments"}})))
+	b.add(dto)
+
+	body, err := json.Marshal(b.dto())
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"streams":[{"stream":{"app":"payments"},"values":[["0","started"],["1","charged",{"trace_id":"4bf92f35"}]]}]}`, string(body))
+}
+
+func Test_marshalProto(t *testing.T) {
+	dto := &lokiDTO{Streams: []streams{{
+		Stream:   map[string]string{"pod": "api", "app": "pay\"ments"},
+		Values:   [][]string{{"1696118400000000123", "charged"}, {"0", "started"}},
+		Metadata: []map[string]string{{"trace_id": "4bf92f35"}},
+	}}}
+
+	b, err := dto.marshalProto()
+	assert.Nil(t, err)
+
+	stream := fields(t, b, 1)
+	assert.Len(t, stream, 1)
+	assert.Equal(t, [][]byte{[]byte(`{app="pay\"ments", pod="api"}`)}, fields(t, stream[0], 1))
+
+	entries := fields(t, stream[0], 2)
+	assert.Len(t, entries, 2)
+
+	timestamp := fields(t, entries[0], 1)[0]
+	seconds, l := protowire.ConsumeVarint(timestamp[1:])
+	nanos, _ := protowire.ConsumeVarint(timestamp[1+l+1:])
+	assert.Equal(t, uint64(1696118400), seconds)
+	assert.Equal(t, uint64(123), nanos)
+	assert.Equal(t, [][]byte{[]byte("charged")}, fields(t, entries[0], 2))
+
+	metadata := fields(t, entries[0], 3)
+	assert.Len(t, metadata, 1)
+	assert.Equal(t, [][]byte{[]byte("trace_id")}, fields(t, metadata[0], 1))
+	assert.Equal(t, [][]byte{[]byte("4bf92f35")}, fields(t, metadata[0], 2))
+
+	assert.Empty(t, fields(t, entries[1], 1)[0])
+	assert.Empty(t, fields(t, entries[1], 3))
+
+	dto.Streams[0].Values[0][0] = "yesterday"
+	_, err = dto.marshalProto()
+	assert.ErrorContains(t, err, `invalid timestamp "yesterday"`)
+}
+
+func Test_StreamProtobuf(t *testing.T) {
+	bodies := make(chan []byte, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "payments", r.Header.Get("X-Scope-OrgID"))
+
+		b, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		body, err := snappy.Decode(nil, b)
+		assert.Nil(t, err)
+
+		bodies <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	l := New().
+		Url(server.URL).
+		Client(&http.Client{}).
+		Tenant(template.Must(template.New("tenant").Parse("payments"))).
+		Encoding(EncodingProtobuf).
+		StructuredMetadata("trace_id").
+		LogChannel(ch).
+		ErrChannel(errCh).
+		Build()
+
+	ch <- backend.RawLog{Log: "charged", Timestamp: "1", Metadata: map[string]string{"app": "payments", "trace_id": "4bf92f35"}}
+	l.Close()
+	l.Stream()
+
+	assert.Empty(t, errCh)
+
+	expected, err := (&lokiDTO{Streams: []streams{{
+		Stream:   map[string]string{"app": "payments"},
+		Values:   [][]string{{"1", "charged"}},
+		Metadata: []map[string]string{{"trace_id": "4bf92f35"}},
+	}}}).marshalProto()
+	assert.Nil(t, err)
+	assert.True(t, bytes.Equal(expected, <-bodies))
+}
+
+func Test_relabel(t *testing.T) {
+	l := New().
+		Relabel(ActionDrop, []string{"namespace"}, "", regexp.MustCompile("^kube-system$"), "", "").
+		Relabel(ActionKeep, []string{"namespace", "app"}, "/", regexp.MustCompile("^payments/.+$"), "", "").
+		Relabel(ActionReplace, []string{"pod"}, "", regexp.MustCompile("^(.+)-[a-z0-9]+-[a-z0-9]+$"), "workload", DefaultReplacement).
+		Relabel(ActionReplace, []string{"missing"}, "", nil, "app", DefaultReplacement).
+		Relabel(ActionLabelMap, nil, "", regexp.MustCompile("^app_kubernetes_io_(.+)$"), "", DefaultReplacement).
+		StructuredMetadata("trace_id").
+		AllowLabels("namespace", "app", "workload", "version", "pod_template_hash").
+		DenyLabels("pod_template_hash").
+		Build()
+
+	labels := map[string]string{
+		"namespace":                 "payments",
+		"app":                       "api",
+		"pod":                       "api-7d4b9c-x2k8p",
+		"pod_template_hash":         "7d4b9c",
+		"app_kubernetes_io_version": "1.2.3",
+		"trace_id":                  "4bf92f35",
+	}
+
+	dto := l.relabel(l.rawLogToDTO(backend.RawLog{Log: "charged", Timestamp: "1", Metadata: labels}))
+	assert.Equal(t, map[string]string{
+		"namespace": "payments",
+		"workload":  "api",
+		"version":   "1.2.3",
+		"trace_id":  "4bf92f35",
+	}, dto.Streams[0].Stream)
+	assert.Equal(t, "api", labels["app"], "the labels of the log are copied")
+
+	assert.Nil(t, l.relabel(l.rawLogToDTO(backend.RawLog{Metadata: map[string]string{"namespace": "kube-system", "app": "dns"}})))
+	assert.Nil(t, l.relabel(l.rawLogToDTO(backend.RawLog{Metadata: map[string]string{"namespace": "default", "app": "web"}})))
+
+	// an empty replacement clears the target label
+	l = New().Relabel(ActionReplace, []string{"namespace"}, "", regexp.MustCompile("^payments$"), "pod", "").Build()
+	dto = l.relabel(l.rawLogToDTO(backend.RawLog{Log: "charged", Timestamp: "1", Metadata: map[string]string{"namespace": "payments", "pod": "api-7d4b9c-x2k8p"}}))
+	assert.Equal(t, map[string]string{"namespace": "payments"}, dto.Streams[0].Stream)
+}
+
+func Test_StreamRelabel(t *testing.T) {
+	bodies := make(chan string, 2)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		bodies <- string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	ch := make(chan backend.RawLog, 2)
+	errCh := make(chan error, 1)
+
+	l := New().
+		Url(server.URL).
+		Client(&http.Client{}).
+		Relabel(ActionDrop, []string{"container"}, "", regexp.MustCompile("^istio-proxy$"), "", "").
+		DenyLabels("pod_template_hash").
+		LogChannel(ch).
+		ErrChannel(errCh).
+		Build()
+
+	ch <- backend.RawLog{Log: "upstream connect", Timestamp: "1", Metadata: map[string]string{"container": "istio-proxy"}}
+	// the pod-template-hash label, as logs are labelled
+	ch <- backend.RawLog{Log: "charged", Timestamp: "2", Metadata: map[string]string{"container": "api", "pod_template_hash": "7d4b9c"}}
+	l.Close()
+	l.Stream()
+
+	assert.Empty(t, errCh)
+	assert.Len(t, bodies, 1)
+	assert.JSONEq(t, `{"streams":[{"stream":{"container":"api"},"values":[["2","charged"]]}]}`, <-bodies)
+}
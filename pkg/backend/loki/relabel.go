@@ -0,0 +1,117 @@
+package loki
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Relabel actions, as in Prometheus relabel_configs.
+const (
+	// ActionReplace sets the target label to the replacement
+	// when the regex matches the source labels, removing it
+	// when the replacement expands to nothing.
+	ActionReplace = "replace"
+	// ActionKeep drops entries whose source
+	// labels don't match the regex.
+	ActionKeep = "keep"
+	// ActionDrop drops entries whose source
+	// labels match the regex.
+	ActionDrop = "drop"
+	// ActionLabelMap copies the labels whose name matches
+	// the regex to the name the replacement expands to.
+	ActionLabelMap = "labelmap"
+
+	DefaultSeparator   = ";"
+	DefaultReplacement = "$1"
+)
+
+var defaultRegex = regexp.MustCompile("^(?:(.*))$")
+
+type rule struct {
+	action       string
+	sourceLabels []string
+	separator    string
+	regex        *regexp.Regexp
+	targetLabel  string
+	replacement  string
+}
+
+// apply runs the rule on the labels in place,
+// and reports whether the entry is kept.
+func (r rule) apply(labels map[string]string) bool {
+	values := make([]string, len(r.sourceLabels))
+	for i, name := range r.sourceLabels {
+		values[i] = labels[name]
+	}
+	value := strings.Join(values, r.separator)
+
+	switch r.action {
+	case ActionKeep:
+		return r.regex.MatchString(value)
+
+	case ActionDrop:
+		return !r.regex.MatchString(value)
+
+	case ActionReplace:
+		match := r.regex.FindStringSubmatchIndex(value)
+		if match == nil {
+			return true
+		}
+
+		if replaced := string(r.regex.ExpandString(nil, r.replacement, value, match)); replaced != "" {
+			labels[r.targetLabel] = replaced
+		} else {
+			delete(labels, r.targetLabel)
+		}
+
+	case ActionLabelMap:
+		mapped := map[string]string{}
+		for name, v := range labels {
+			if match := r.regex.FindStringSubmatchIndex(name); match != nil {
+				mapped[string(r.regex.ExpandString(nil, r.replacement, name, match))] = v
+			}
+		}
+		for name, v := range mapped {
+			labels[name] = v
+		}
+	}
+
+	return true
+}
+
+// relabel runs the rules on a copy of the labels of
+// each stream, then keeps the allowed stream labels.
+// It returns nil when an entry is dropped.
+func (l *loki) relabel(dto *lokiDTO) *lokiDTO {
+	if len(l.rules) == 0 && len(l.allow) == 0 && len(l.deny) == 0 {
+		return dto
+	}
+
+	for i, s := range dto.Streams {
+		labels := make(map[string]string, len(s.Stream))
+		for k, v := range s.Stream {
+			labels[k] = v
+		}
+
+		for _, r := range l.rules {
+			if !r.apply(labels) {
+				return nil
+			}
+		}
+
+		for k := range labels {
+			// structured metadata isn't a stream label
+			if slices.Contains(l.metadata, k) {
+				continue
+			}
+
+			if (len(l.allow) > 0 && !slices.Contains(l.allow, k)) || slices.Contains(l.deny, k) {
+				delete(labels, k)
+			}
+		}
+
+		dto.Streams[i].Stream = labels
+	}
+	return dto
+}
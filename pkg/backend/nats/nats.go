@@ -0,0 +1,346 @@
+package nats
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/phil-inc/admiral/pkg/backend"
+)
+
+const (
+	DefaultLogSubject   = "admiral.{{.cluster}}.logs.{{.namespace}}.{{.pod}}"
+	DefaultEventSubject = "admiral.{{.cluster}}.events.{{.namespace}}.{{.reason}}"
+	DefaultAckTimeout   = 5 * time.Second
+
+	// maxRetries is how many times a message is published
+	// again when it couldn't be, or wasn't acknowledged.
+	maxRetries = 3
+)
+
+type Builder struct {
+	url          string
+	tlsConfig    *tls.Config
+	token        string
+	cluster      string
+	logChannel   chan backend.RawLog
+	eventChannel chan backend.Event
+	errChannel   chan error
+	logSubject   *template.Template
+	eventSubject *template.Template
+	jetStream    bool
+	ackTimeout   time.Duration
+}
+
+// New returns a builder for the nats struct.
+func New() *Builder {
+	return &Builder{
+		logSubject:   template.Must(template.New("subject").Option("missingkey=zero").Parse(DefaultLogSubject)),
+		eventSubject: template.Must(template.New("subject").Option("missingkey=zero").Parse(DefaultEventSubject)),
+	}
+}
+
+// Url sets the NATS servers, comma separated.
+// Credentials may be set in their user info.
+func (b *Builder) Url(url string) *Builder {
+	b.url = url
+	return b
+}
+
+// TLSConfig enables TLS on the connection.
+func (b *Builder) TLSConfig(tlsConfig *tls.Config) *Builder {
+	b.tlsConfig = tlsConfig
+	return b
+}
+
+// Token authenticates the connection with a token.
+func (b *Builder) Token(token string) *Builder {
+	b.token = token
+	return b
+}
+
+// Cluster sets the cluster name logs
+// are published with in their subject.
+func (b *Builder) Cluster(cluster string) *Builder {
+	b.cluster = cluster
+	return b
+}
+
+// LogChannel sets the channel from where
+// nats will take logs.
+func (b *Builder) LogChannel(logChannel chan backend.RawLog) *Builder {
+	b.logChannel = logChannel
+	return b
+}
+
+// EventChannel sets the channel from where
+// nats will take events.
+func (b *Builder) EventChannel(eventChannel chan backend.Event) *Builder {
+	b.eventChannel = eventChannel
+	return b
+}
+
+// ErrChannel sets the channel where nats
+// will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// Subject sets the template rendering the subject
+// of a log from its labels and the cluster, or of an
+// event from its fields, replacing DefaultLogSubject
+// and DefaultEventSubject.
+func (b *Builder) Subject(subject *template.Template) *Builder {
+	b.logSubject = subject
+	b.eventSubject = subject
+	return b
+}
+
+// JetStream publishes to JetStream, waiting at most
+// ackTimeout for each message to be acknowledged.
+func (b *Builder) JetStream(enabled bool, ackTimeout time.Duration) *Builder {
+	b.jetStream = enabled
+	b.ackTimeout = ackTimeout
+	return b
+}
+
+// Build returns a configured nats struct.
+func (b *Builder) Build() *nats {
+	ackTimeout := b.ackTimeout
+	if ackTimeout <= 0 {
+		ackTimeout = DefaultAckTimeout
+	}
+
+	return &nats{
+		url:          b.url,
+		tlsConfig:    b.tlsConfig,
+		token:        b.token,
+		cluster:      b.cluster,
+		logChannel:   b.logChannel,
+		eventChannel: b.eventChannel,
+		errChannel:   b.errChannel,
+		logSubject:   b.logSubject,
+		eventSubject: b.eventSubject,
+		jetStream:    b.jetStream,
+		ackTimeout:   ackTimeout,
+		backoff:      time.Second,
+	}
+}
+
+type nats struct {
+	url          string
+	tlsConfig    *tls.Config
+	token        string
+	cluster      string
+	logChannel   chan backend.RawLog
+	eventChannel chan backend.Event
+	errChannel   chan error
+	logSubject   *template.Template
+	eventSubject *template.Template
+	jetStream    bool
+	ackTimeout   time.Duration
+	backoff      time.Duration
+	conn         *natsgo.Conn
+	js           jetstream.JetStream
+	mutex        sync.Mutex
+}
+
+type logMessage struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Log       string            `json:"log"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// Stream publishes whatever is received on logChannel
+// and eventChannel, until both are closed.
+func (n *nats) Stream() {
+	defer n.disconnect()
+
+	logChannel, eventChannel := n.logChannel, n.eventChannel
+
+	for logChannel != nil || eventChannel != nil {
+		select {
+		case raw, ok := <-logChannel:
+			if !ok {
+				logChannel = nil
+				continue
+			}
+			n.publishLog(raw)
+
+		case event, ok := <-eventChannel:
+			if !ok {
+				eventChannel = nil
+				continue
+			}
+			n.publishEvent(event)
+		}
+	}
+}
+
+func (n *nats) publishLog(r backend.RawLog) {
+	data := map[string]string{"cluster": n.cluster}
+	for k, v := range r.Metadata {
+		data[k] = v
+	}
+
+	subject, err := n.renderSubject(n.logSubject, data)
+	if err != nil {
+		n.errChannel <- err
+		return
+	}
+
+	t := time.Now()
+	if ns, err := strconv.ParseInt(r.Timestamp, 10, 64); err == nil {
+		t = time.Unix(0, ns)
+	}
+
+	payload, err := json.Marshal(logMessage{Timestamp: t, Log: r.Log, Labels: r.Metadata})
+	if err != nil {
+		n.errChannel <- err
+		return
+	}
+
+	n.publish(subject, payload)
+}
+
+func (n *nats) publishEvent(e backend.Event) {
+	subject, err := n.renderSubject(n.eventSubject, e.Fields())
+	if err != nil {
+		n.errChannel <- err
+		return
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		n.errChannel <- err
+		return
+	}
+
+	n.publish(subject, payload)
+}
+
+// renderSubject rejects the subjects NATS
+// can't publish to, such as those with an
+// empty token left by a missing label.
+func (n *nats) renderSubject(subject *template.Template, data map[string]string) (string, error) {
+	var buf strings.Builder
+	if err := subject.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	s := buf.String()
+	for _, token := range strings.Split(s, ".") {
+		if token == "" || token == "*" || token == ">" || strings.ContainsAny(token, " \t\r\n") {
+			return "", fmt.Errorf("nats: invalid subject %q", s)
+		}
+	}
+	return s, nil
+}
+
+// publish retries until the message is published, or
+// acknowledged with JetStream. Its id is kept across
+// retries so that JetStream discards the duplicates
+// of a message whose ack was lost.
+func (n *nats) publish(subject string, payload []byte) {
+	id := uuid.NewString()
+
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(n.backoff * time.Duration(attempt))
+		}
+
+		if err = n.send(subject, id, payload); err == nil {
+			return
+		}
+	}
+
+	n.errChannel <- fmt.Errorf("nats: dropped a message to %s after %d retries: %w", subject, maxRetries, err)
+}
+
+func (n *nats) send(subject, id string, payload []byte) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.conn == nil {
+		if err := n.connect(); err != nil {
+			return err
+		}
+	}
+
+	msg := &natsgo.Msg{Subject: subject, Data: payload}
+	if !n.jetStream {
+		return n.conn.PublishMsg(msg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.ackTimeout)
+	defer cancel()
+
+	_, err := n.js.PublishMsg(ctx, msg, jetstream.WithMsgID(id))
+	return err
+}
+
+// connect dials the servers, after which
+// the client reconnects by itself.
+func (n *nats) connect() error {
+	opts := []natsgo.Option{natsgo.Name("admiral"), natsgo.MaxReconnects(-1)}
+	if n.tlsConfig != nil {
+		opts = append(opts, natsgo.Secure(n.tlsConfig))
+	}
+	if n.token != "" {
+		opts = append(opts, natsgo.Token(n.token))
+	}
+
+	conn, err := natsgo.Connect(n.url, opts...)
+	if err != nil {
+		return err
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	n.conn, n.js = conn, js
+	return nil
+}
+
+// disconnect flushes what is
+// buffered before closing.
+func (n *nats) disconnect() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.conn == nil {
+		return
+	}
+
+	if err := n.conn.Flush(); err != nil {
+		n.errChannel <- err
+	}
+	n.conn.Close()
+	n.conn = nil
+}
+
+// Close closes the injected channels. Anything
+// already on the stack will get published.
+func (n *nats) Close() {
+	if n.logChannel != nil {
+		close(n.logChannel)
+	}
+
+	if n.eventChannel != nil {
+		close(n.eventChannel)
+	}
+}
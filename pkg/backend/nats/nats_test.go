@@ -0,0 +1,205 @@
+package nats
+
+import (
+	"context"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+// runServer runs an embedded NATS server with JetStream
+// and a stream on the subjects of the test cluster.
+func runServer(t *testing.T, token string) *server.Server {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	opts.Authorization = token
+
+	s := natsserver.RunServer(&opts)
+	t.Cleanup(s.Shutdown)
+
+	conn, err := natsgo.Connect(s.ClientURL(), natsgo.Token(token))
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	js, err := jetstream.New(conn)
+	assert.Nil(t, err)
+
+	_, err = js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "admiral", Subjects: []string{"admiral.test.>"}})
+	assert.Nil(t, err)
+	return s
+}
+
+// stored waits for the stream to hold n
+// messages, then returns them in order.
+func stored(t *testing.T, s *server.Server, token string, n int) []*jetstream.RawStreamMsg {
+	conn, err := natsgo.Connect(s.ClientURL(), natsgo.Token(token))
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	js, err := jetstream.New(conn)
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	stream, err := js.Stream(ctx, "admiral")
+	assert.Nil(t, err)
+
+	assert.Eventually(t, func() bool {
+		info, err := stream.Info(ctx)
+		return err == nil && info.State.Msgs >= uint64(n)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	messages := []*jetstream.RawStreamMsg{}
+	for seq := uint64(1); seq <= uint64(n); seq++ {
+		m, err := stream.GetMsg(ctx, seq)
+		if assert.Nil(t, err) {
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
+
+func Test_Build(t *testing.T) {
+	ch := make(chan backend.RawLog)
+	events := make(chan backend.Event)
+	errCh := make(chan error)
+	subject := template.Must(template.New("subject").Parse("admiral.{{.namespace}}"))
+
+	n := New().Url("nats://127.0.0.1:4222").Cluster("test").Subject(subject).LogChannel(ch).EventChannel(events).ErrChannel(errCh).JetStream(true, 0).Build()
+
+	assert.Equal(t, "nats://127.0.0.1:4222", n.url)
+	assert.Equal(t, "test", n.cluster)
+	assert.Equal(t, subject, n.logSubject)
+	assert.Equal(t, subject, n.eventSubject)
+	assert.Equal(t, ch, n.logChannel)
+	assert.Equal(t, events, n.eventChannel)
+	assert.Equal(t, errCh, n.errChannel)
+	assert.True(t, n.jetStream)
+	assert.Equal(t, DefaultAckTimeout, n.ackTimeout)
+}
+
+func Test_renderSubject(t *testing.T) {
+	n := New().Cluster("test").Build()
+
+	s, err := n.renderSubject(n.eventSubject, map[string]string{"cluster": "test", "namespace": "hello", "reason": "BackOff"})
+	assert.Nil(t, err)
+	assert.Equal(t, "admiral.test.events.hello.BackOff", s)
+
+	for _, data := range []map[string]string{
+		{"cluster": "test", "namespace": "hello"},
+		{"cluster": "test", "namespace": "hello", "reason": "*"},
+		{"cluster": "test", "namespace": "hello", "reason": "Back Off"},
+	} {
+		_, err = n.renderSubject(n.eventSubject, data)
+		assert.NotNil(t, err, data)
+	}
+}
+
+func Test_Stream(t *testing.T) {
+	s := runServer(t, "")
+
+	ch := make(chan backend.RawLog, 2)
+	events := make(chan backend.Event, 1)
+	errCh := make(chan error, 1)
+
+	n := New().Url(s.ClientURL()).Cluster("test").LogChannel(ch).EventChannel(events).ErrChannel(errCh).Build()
+
+	ch <- backend.RawLog{Log: "some log", Timestamp: "1696118400000000000", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	ch <- backend.RawLog{Log: "some log", Metadata: map[string]string{"pod": "world"}}
+	events <- backend.Event{Cluster: "test", Namespace: "hello", Name: "world", Reason: "BackOff"}
+	n.Close()
+	n.Stream()
+
+	err := <-errCh
+	assert.Equal(t, `nats: invalid subject "admiral.test.logs..world"`, err.Error())
+
+	messages := stored(t, s, "", 2)
+	assert.Len(t, messages, 2)
+
+	subjects := []string{}
+	for _, m := range messages {
+		subjects = append(subjects, m.Subject)
+		assert.Empty(t, m.Header)
+
+		if m.Subject == "admiral.test.logs.hello.world" {
+			assert.JSONEq(t, `{"timestamp":"`+time.Unix(0, 1696118400000000000).Format(time.RFC3339Nano)+`","log":"some log","labels":{"namespace":"hello","pod":"world"}}`, string(m.Data))
+		}
+	}
+	assert.ElementsMatch(t, []string{"admiral.test.logs.hello.world", "admiral.test.events.hello.BackOff"}, subjects)
+}
+
+func Test_StreamJetStream(t *testing.T) {
+	s := runServer(t, "secret")
+
+	ch := make(chan backend.RawLog, 2)
+	errCh := make(chan error, 1)
+
+	n := New().Url(s.ClientURL()).Token("secret").Cluster("test").LogChannel(ch).ErrChannel(errCh).JetStream(true, time.Second).Build()
+
+	ch <- backend.RawLog{Log: "some log", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	ch <- backend.RawLog{Log: "other log", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	n.Close()
+	n.Stream()
+
+	assert.Empty(t, errCh)
+
+	messages := stored(t, s, "secret", 2)
+	assert.Len(t, messages, 2)
+	assert.NotEmpty(t, messages[0].Header.Get(natsgo.MsgIdHdr))
+	assert.NotEqual(t, messages[0].Header.Get(natsgo.MsgIdHdr), messages[1].Header.Get(natsgo.MsgIdHdr))
+}
+
+func Test_StreamErr(t *testing.T) {
+	s := runServer(t, "")
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	// no stream is bound to the subjects of another cluster
+	n := New().Url(s.ClientURL()).Cluster("other").LogChannel(ch).ErrChannel(errCh).JetStream(true, time.Second).Build()
+	n.backoff = 0
+
+	ch <- backend.RawLog{Log: "some log", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	n.Close()
+	n.Stream()
+
+	err := <-errCh
+	assert.Contains(t, err.Error(), "nats: dropped a message to admiral.other.logs.hello.world after 3 retries")
+	assert.ErrorIs(t, err, jetstream.ErrNoStreamResponse)
+
+	// with the wrong token
+	ch = make(chan backend.RawLog, 1)
+	s = runServer(t, "secret")
+	n = New().Url(s.ClientURL()).Token("invalid").Cluster("test").LogChannel(ch).ErrChannel(errCh).Build()
+	n.backoff = 0
+
+	ch <- backend.RawLog{Log: "some log", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	n.Close()
+	n.Stream()
+
+	err = <-errCh
+	assert.ErrorIs(t, err, natsgo.ErrAuthorization)
+
+	// without a server
+	url := s.ClientURL()
+	s.Shutdown()
+
+	ch = make(chan backend.RawLog, 1)
+	n = New().Url(url).Cluster("test").LogChannel(ch).ErrChannel(errCh).Build()
+	n.backoff = 0
+
+	ch <- backend.RawLog{Log: "some log", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	n.Close()
+	n.Stream()
+
+	err = <-errCh
+	assert.ErrorIs(t, err, natsgo.ErrNoServers)
+}
@@ -0,0 +1,242 @@
+package opsgenie
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/phil-inc/admiral/pkg/utils"
+)
+
+const (
+	// DefaultURL is the Opsgenie API; EU accounts
+	// use https://api.eu.opsgenie.com instead.
+	DefaultURL = "https://api.opsgenie.com"
+
+	// DefaultPriority is used when no rule matches.
+	DefaultPriority = "P3"
+
+	// maxRetries is how many times a rate-limited
+	// request is retried before it is dropped.
+	maxRetries = 3
+
+	// maxMessageLength is the longest message,
+	// in characters, Opsgenie accepts on an alert.
+	maxMessageLength = 130
+
+	// maxAliasLength and maxTagLength are the longest
+	// alias and tags, in characters, Opsgenie accepts.
+	maxAliasLength = 512
+	maxTagLength   = 50
+
+	source = "admiral"
+)
+
+type Builder struct {
+	url          string
+	client       *http.Client
+	eventChannel chan backend.Event
+	errChannel   chan error
+	apiKey       string
+	rules        []rule
+	recoveries   map[string][]string
+}
+
+// New returns a builder for the opsgenie struct.
+func New() *Builder {
+	return &Builder{
+		recoveries: make(map[string][]string),
+	}
+}
+
+// Url sets the Opsgenie API url, defaulting to DefaultURL.
+func (b *Builder) Url(url string) *Builder {
+	b.url = url
+	return b
+}
+
+// EventChannel sets the channel from where
+// opsgenie will take events.
+func (b *Builder) EventChannel(eventChannel chan backend.Event) *Builder {
+	b.eventChannel = eventChannel
+	return b
+}
+
+// ErrChannel sets the channel where opsgenie
+// will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// Client sets the HTTP client.
+func (b *Builder) Client(client *http.Client) *Builder {
+	b.client = client
+	return b
+}
+
+// APIKey sets the key of the Opsgenie API integration.
+func (b *Builder) APIKey(apiKey string) *Builder {
+	b.apiKey = apiKey
+	return b
+}
+
+// Priority adds a rule giving alerts the priority (P1-P5)
+// when the event matches the reason and type. An empty
+// reason or type matches any, and the first match wins.
+func (b *Builder) Priority(reason string, eventType string, priority string) *Builder {
+	b.rules = append(b.rules, rule{reason: reason, eventType: eventType, priority: priority})
+	return b
+}
+
+// Recovery pairs a problem reason with the reason that
+// closes its alert, e.g. NodeNotReady with NodeReady.
+func (b *Builder) Recovery(problem string, recovery string) *Builder {
+	b.recoveries[recovery] = append(b.recoveries[recovery], problem)
+	return b
+}
+
+// Build returns a configured opsgenie struct.
+func (b *Builder) Build() *opsgenie {
+	u := b.url
+	if u == "" {
+		u = DefaultURL
+	}
+
+	return &opsgenie{
+		url:          strings.TrimSuffix(u, "/"),
+		client:       b.client,
+		eventChannel: b.eventChannel,
+		errChannel:   b.errChannel,
+		headers:      map[string]string{"Authorization": "GenieKey " + b.apiKey},
+		rules:        b.rules,
+		recoveries:   b.recoveries,
+	}
+}
+
+type opsgenie struct {
+	url          string
+	client       *http.Client
+	eventChannel chan backend.Event
+	errChannel   chan error
+	headers      map[string]string
+	rules        []rule
+	recoveries   map[string][]string
+}
+
+type rule struct {
+	reason    string
+	eventType string
+	priority  string
+}
+
+type alertDTO struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description"`
+	Tags        []string          `json:"tags"`
+	Details     map[string]string `json:"details"`
+	Entity      string            `json:"entity"`
+	Source      string            `json:"source"`
+	Priority    string            `json:"priority"`
+}
+
+type closeDTO struct {
+	Source string `json:"source"`
+	Note   string `json:"note"`
+}
+
+// Stream waits to receive something on eventChannel, then
+// creates an alert, or closes the alerts the event is a
+// recovery from.
+func (o *opsgenie) Stream() {
+	for event := range o.eventChannel {
+		if problems, ok := o.recoveries[event.Reason]; ok {
+			for _, problem := range problems {
+				o.send(o.closeURL(alias(event, problem)), closeToDTO(event))
+			}
+			continue
+		}
+
+		o.send(o.url+"/v2/alerts", o.eventToDTO(event))
+	}
+}
+
+func (o *opsgenie) send(u string, dto interface{}) {
+	err := utils.SendWithRetry(dto, "POST", u, o.headers, o.client, maxRetries)
+	if err != nil {
+		o.errChannel <- err
+	}
+}
+
+func (o *opsgenie) closeURL(alias string) string {
+	return fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias", o.url, url.PathEscape(alias))
+}
+
+func (o *opsgenie) eventToDTO(event backend.Event) *alertDTO {
+	tags := []string{truncate("cluster:"+event.Cluster, maxTagLength)}
+	if event.Namespace != "" {
+		tags = append(tags, truncate("namespace:"+event.Namespace, maxTagLength))
+	}
+
+	message := fmt.Sprintf("%s: %s %s/%s", event.Cluster, event.Reason, strings.ToLower(event.Kind), event.Name)
+
+	return &alertDTO{
+		Message:     truncate(message, maxMessageLength),
+		Alias:       alias(event, event.Reason),
+		Description: event.Message,
+		Tags:        tags,
+		Details: map[string]string{
+			"cluster":   event.Cluster,
+			"namespace": event.Namespace,
+			"kind":      event.Kind,
+			"object":    event.Name,
+			"reason":    event.Reason,
+			"type":      event.Type,
+		},
+		Entity:   fmt.Sprintf("%s/%s", strings.ToLower(event.Kind), event.Name),
+		Source:   source,
+		Priority: o.priority(event),
+	}
+}
+
+func (o *opsgenie) priority(event backend.Event) string {
+	for _, r := range o.rules {
+		if (r.reason == "" || r.reason == event.Reason) &&
+			(r.eventType == "" || r.eventType == event.Type) {
+			return r.priority
+		}
+	}
+	return DefaultPriority
+}
+
+func closeToDTO(event backend.Event) *closeDTO {
+	return &closeDTO{
+		Source: source,
+		Note:   fmt.Sprintf("%s: %s", event.Reason, event.Message),
+	}
+}
+
+// alias identifies the alert of an involved object
+// having a problem, so alerts for it are deduplicated
+// and a recovery can close it.
+func alias(event backend.Event, reason string) string {
+	return truncate(strings.Join([]string{event.Cluster, event.Namespace, event.Kind, event.Name, reason}, "/"), maxAliasLength)
+}
+
+// truncate cuts s to max characters, so
+// that multi-byte ones aren't split.
+func truncate(s string, max int) string {
+	if r := []rune(s); len(r) > max {
+		return string(r[:max])
+	}
+	return s
+}
+
+// Close closes the eventChannel. Anything
+// already on the stack will get processed.
+func (o *opsgenie) Close() {
+	close(o.eventChannel)
+}
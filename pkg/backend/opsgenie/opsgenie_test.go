@@ -0,0 +1,136 @@
+package opsgenie
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+var mocked_event = backend.Event{
+	Cluster:   "hello-cluster",
+	Namespace: "hello-namespace",
+	Kind:      "Pod",
+	Name:      "hello-pod",
+	Reason:    "BackOff",
+	Type:      "Warning",
+	Message:   "Back-off restarting failed container",
+}
+
+func Test_Build(t *testing.T) {
+	cli := &http.Client{}
+	ch := make(chan backend.Event)
+
+	o := New().Client(cli).EventChannel(ch).APIKey("key").Url("https://api.eu.opsgenie.com/").Build()
+
+	assert.NotNil(t, o)
+	assert.Equal(t, "https://api.eu.opsgenie.com", o.url)
+	assert.Equal(t, "GenieKey key", o.headers["Authorization"])
+	assert.Equal(t, ch, o.eventChannel)
+	assert.Equal(t, DefaultURL, New().Build().url)
+}
+
+func Test_priority(t *testing.T) {
+	o := New().Priority("NodeNotReady", "", "P1").Priority("", "Warning", "P2").Build()
+
+	e := mocked_event
+	assert.Equal(t, "P2", o.priority(e))
+
+	e.Reason = "NodeNotReady"
+	assert.Equal(t, "P1", o.priority(e))
+
+	e.Reason = "Pulled"
+	e.Type = "Normal"
+	assert.Equal(t, DefaultPriority, o.priority(e))
+}
+
+func Test_eventToDTO(t *testing.T) {
+	o := New().Build()
+
+	dto := o.eventToDTO(mocked_event)
+
+	assert.Equal(t, "hello-cluster: BackOff pod/hello-pod", dto.Message)
+	assert.Equal(t, "hello-cluster/hello-namespace/Pod/hello-pod/BackOff", dto.Alias)
+	assert.Equal(t, mocked_event.Message, dto.Description)
+	assert.ElementsMatch(t, []string{"cluster:hello-cluster", "namespace:hello-namespace"}, dto.Tags)
+	assert.Equal(t, "pod/hello-pod", dto.Entity)
+	assert.Equal(t, DefaultPriority, dto.Priority)
+
+	// long messages are cut between characters
+	long := mocked_event
+	long.Name = strings.Repeat("é", maxMessageLength)
+	dto = o.eventToDTO(long)
+	assert.True(t, utf8.ValidString(dto.Message))
+	assert.Equal(t, maxMessageLength, utf8.RuneCountInString(dto.Message))
+
+	// so are long aliases and tags
+	long.Namespace = strings.Repeat("é", maxAliasLength)
+	dto = o.eventToDTO(long)
+	assert.True(t, utf8.ValidString(dto.Alias))
+	assert.Equal(t, maxAliasLength, utf8.RuneCountInString(dto.Alias))
+	assert.Equal(t, "namespace:"+strings.Repeat("é", maxTagLength-len("namespace:")), dto.Tags[1])
+}
+
+func Test_Stream(t *testing.T) {
+	var mutex sync.Mutex
+	paths := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GenieKey key", r.Header.Get("Authorization"))
+
+		b, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.Contains(t, string(b), "admiral")
+
+		mutex.Lock()
+		paths = append(paths, r.URL.EscapedPath()+"?"+r.URL.RawQuery)
+		mutex.Unlock()
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	ch := make(chan backend.Event, 2)
+	errCh := make(chan error, 2)
+
+	o := New().Client(&http.Client{}).Url(server.URL).APIKey("key").Recovery("BackOff", "Started").EventChannel(ch).ErrChannel(errCh).Build()
+
+	recovery := mocked_event
+	recovery.Reason = "Started"
+	recovery.Type = "Normal"
+
+	ch <- mocked_event
+	ch <- recovery
+	o.Close()
+	o.Stream()
+
+	assert.Empty(t, errCh)
+	assert.Equal(t, []string{
+		"/v2/alerts?",
+		"/v2/alerts/hello-cluster%2Fhello-namespace%2FPod%2Fhello-pod%2FBackOff/close?identifierType=alias",
+	}, paths)
+}
+
+func Test_StreamErr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message":"Key format is not valid!"}`))
+	}))
+
+	ch := make(chan backend.Event, 1)
+	errCh := make(chan error, 1)
+
+	o := New().Client(&http.Client{}).Url(server.URL).EventChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- mocked_event
+	o.Close()
+	o.Stream()
+
+	err := <-errCh
+	assert.Contains(t, err.Error(), "Key format is not valid!")
+}
@@ -0,0 +1,150 @@
+package otlp
+
+import (
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The types below mirror the subset of the OTLP logs
+// data model admiral exports. They marshal to the
+// OTLP/JSON encoding with encoding/json, and to the
+// OTLP/protobuf encoding with marshalProto.
+
+type exportLogsServiceRequest struct {
+	ResourceLogs []resourceLogs `json:"resourceLogs"`
+}
+
+type resourceLogs struct {
+	Resource  resource    `json:"resource"`
+	ScopeLogs []scopeLogs `json:"scopeLogs"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeLogs struct {
+	Scope      scope       `json:"scope"`
+	LogRecords []logRecord `json:"logRecords"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type logRecord struct {
+	TimeUnixNano         uint64     `json:"timeUnixNano,string"`
+	ObservedTimeUnixNano uint64     `json:"observedTimeUnixNano,string"`
+	SeverityNumber       int32      `json:"severityNumber,omitempty"`
+	SeverityText         string     `json:"severityText,omitempty"`
+	Body                 anyValue   `json:"body"`
+	Attributes           []keyValue `json:"attributes,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func (r *exportLogsServiceRequest) marshalProto() []byte {
+	var b []byte
+	for _, rl := range r.ResourceLogs {
+		b = appendMessage(b, 1, rl.marshalProto())
+	}
+	return b
+}
+
+func (r *resourceLogs) marshalProto() []byte {
+	b := appendMessage(nil, 1, r.Resource.marshalProto())
+	for _, sl := range r.ScopeLogs {
+		b = appendMessage(b, 2, sl.marshalProto())
+	}
+	return b
+}
+
+func (r *resource) marshalProto() []byte {
+	var b []byte
+	for _, kv := range r.Attributes {
+		b = appendMessage(b, 1, kv.marshalProto())
+	}
+	return b
+}
+
+func (s *scopeLogs) marshalProto() []byte {
+	b := appendMessage(nil, 1, s.Scope.marshalProto())
+	for _, lr := range s.LogRecords {
+		b = appendMessage(b, 2, lr.marshalProto())
+	}
+	return b
+}
+
+func (s *scope) marshalProto() []byte {
+	return appendString(nil, 1, s.Name)
+}
+
+func (l *logRecord) marshalProto() []byte {
+	var b []byte
+
+	b = protowire.AppendTag(b, 1, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, l.TimeUnixNano)
+
+	if l.SeverityNumber != 0 {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(l.SeverityNumber))
+	}
+
+	b = appendString(b, 3, l.SeverityText)
+	b = appendMessage(b, 5, l.Body.marshalProto())
+
+	for _, kv := range l.Attributes {
+		b = appendMessage(b, 6, kv.marshalProto())
+	}
+
+	b = protowire.AppendTag(b, 11, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, l.ObservedTimeUnixNano)
+
+	return b
+}
+
+func (kv *keyValue) marshalProto() []byte {
+	b := appendString(nil, 1, kv.Key)
+	return appendMessage(b, 2, kv.Value.marshalProto())
+}
+
+func (v *anyValue) marshalProto() []byte {
+	return appendString(nil, 1, v.StringValue)
+}
+
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+// appendString skips empty strings,
+// as they are the proto3 default.
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func stringKeyValue(key string, value string) keyValue {
+	return keyValue{Key: key, Value: anyValue{StringValue: value}}
+}
+
+// resourceKey identifies a set of resource
+// attributes, to group log records by.
+func resourceKey(attributes []keyValue) string {
+	key := ""
+	for _, kv := range attributes {
+		key += strconv.Quote(kv.Key) + "=" + strconv.Quote(kv.Value.StringValue) + ","
+	}
+	return key
+}
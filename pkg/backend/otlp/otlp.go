@@ -0,0 +1,351 @@
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/phil-inc/admiral/pkg/utils"
+)
+
+const (
+	EncodingProtobuf = "protobuf"
+	EncodingJSON     = "json"
+
+	DefaultBatchSize     = 512
+	DefaultFlushInterval = 5 * time.Second
+
+	logsPath  = "/v1/logs"
+	scopeName = "admiral"
+)
+
+type Builder struct {
+	url           string
+	client        *http.Client
+	logChannel    chan backend.RawLog
+	eventChannel  chan backend.Event
+	errChannel    chan error
+	cluster       string
+	encoding      string
+	headers       map[string]string
+	batchSize     int
+	flushInterval time.Duration
+}
+
+// New returns a builder for the otlp struct.
+func New() *Builder {
+	return &Builder{
+		headers: make(map[string]string),
+	}
+}
+
+// Url takes the OTLP/HTTP endpoint of the
+// collector and builds the full logs url.
+func (b *Builder) Url(url string) *Builder {
+	b.url = strings.TrimSuffix(url, "/") + logsPath
+	return b
+}
+
+// LogChannel sets the channel from where
+// otlp will take logs.
+func (b *Builder) LogChannel(logChannel chan backend.RawLog) *Builder {
+	b.logChannel = logChannel
+	return b
+}
+
+// EventChannel sets the channel from where
+// otlp will take events.
+func (b *Builder) EventChannel(eventChannel chan backend.Event) *Builder {
+	b.eventChannel = eventChannel
+	return b
+}
+
+// ErrChannel sets the channel where otlp
+// will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// Client sets the HTTP client.
+func (b *Builder) Client(client *http.Client) *Builder {
+	b.client = client
+	return b
+}
+
+// Cluster sets the k8s.cluster.name resource attribute.
+func (b *Builder) Cluster(cluster string) *Builder {
+	b.cluster = cluster
+	return b
+}
+
+// Encoding sets whether logs are exported as
+// EncodingProtobuf (default) or EncodingJSON.
+func (b *Builder) Encoding(encoding string) *Builder {
+	b.encoding = encoding
+	return b
+}
+
+// Header adds a header sent with every
+// request, such as for authorization.
+func (b *Builder) Header(name string, value string) *Builder {
+	b.headers[name] = value
+	return b
+}
+
+// Batch sets how many log records are buffered
+// at most, and how long, before an export.
+func (b *Builder) Batch(size int, interval time.Duration) *Builder {
+	b.batchSize = size
+	b.flushInterval = interval
+	return b
+}
+
+// Build returns a configured otlp struct.
+func (b *Builder) Build() *otlp {
+	o := &otlp{
+		url:           b.url,
+		client:        b.client,
+		logChannel:    b.logChannel,
+		eventChannel:  b.eventChannel,
+		errChannel:    b.errChannel,
+		cluster:       b.cluster,
+		encoding:      b.encoding,
+		headers:       b.headers,
+		batchSize:     b.batchSize,
+		flushInterval: b.flushInterval,
+	}
+
+	if o.encoding == "" {
+		o.encoding = EncodingProtobuf
+	}
+	if o.batchSize <= 0 {
+		o.batchSize = DefaultBatchSize
+	}
+	if o.flushInterval <= 0 {
+		o.flushInterval = DefaultFlushInterval
+	}
+
+	return o
+}
+
+type otlp struct {
+	url           string
+	client        *http.Client
+	logChannel    chan backend.RawLog
+	eventChannel  chan backend.Event
+	errChannel    chan error
+	cluster       string
+	encoding      string
+	headers       map[string]string
+	batchSize     int
+	flushInterval time.Duration
+}
+
+// record is a log record along with
+// the attributes of its resource.
+type record struct {
+	resource []keyValue
+	log      logRecord
+}
+
+// Stream buffers logs and events into batches of log
+// records, exporting them once the batch is full, at
+// every flush interval, and when the channels are closed.
+func (o *otlp) Stream() {
+	ticker := time.NewTicker(o.flushInterval)
+	defer ticker.Stop()
+
+	logs, events := o.logChannel, o.eventChannel
+	batch := []record{}
+
+	add := func(r record) {
+		batch = append(batch, r)
+		if len(batch) >= o.batchSize {
+			o.export(batch)
+			batch = []record{}
+		}
+	}
+
+	for logs != nil || events != nil {
+		select {
+		case raw, ok := <-logs:
+			if !ok {
+				logs = nil
+				continue
+			}
+			add(o.rawLogToRecord(raw))
+
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			add(o.eventToRecord(event))
+
+		case <-ticker.C:
+			o.export(batch)
+			batch = []record{}
+		}
+	}
+
+	o.export(batch)
+}
+
+func (o *otlp) rawLogToRecord(r backend.RawLog) record {
+	now := uint64(time.Now().UnixNano())
+
+	t, err := strconv.ParseUint(r.Timestamp, 10, 64)
+	if err != nil {
+		t = now
+	}
+
+	resource := []keyValue{}
+	if o.cluster != "" {
+		resource = append(resource, stringKeyValue("k8s.cluster.name", o.cluster))
+	}
+
+	for k, v := range r.Metadata {
+		switch k {
+		case "namespace":
+			resource = append(resource, stringKeyValue("k8s.namespace.name", v))
+		case "pod":
+			resource = append(resource, stringKeyValue("k8s.pod.name", v))
+		case "container":
+			resource = append(resource, stringKeyValue("k8s.container.name", v))
+		default:
+			resource = append(resource, stringKeyValue("k8s.pod.label."+k, v))
+		}
+	}
+
+	// sort the attributes, so that logs of a
+	// pod always share the same resource
+	sort.Slice(resource, func(i, j int) bool { return resource[i].Key < resource[j].Key })
+
+	severity, severityText := parseSeverity(r.Log)
+
+	return record{
+		resource: resource,
+		log: logRecord{
+			TimeUnixNano:         t,
+			ObservedTimeUnixNano: now,
+			SeverityNumber:       severity,
+			SeverityText:         severityText,
+			Body:                 anyValue{StringValue: r.Log},
+		},
+	}
+}
+
+func (o *otlp) eventToRecord(event backend.Event) record {
+	resource := []keyValue{stringKeyValue("k8s.cluster.name", event.Cluster)}
+	if event.Namespace != "" {
+		resource = append(resource, stringKeyValue("k8s.namespace.name", event.Namespace))
+	}
+
+	severity, severityText := severityInfo, "INFO"
+	if event.IsWarning() {
+		severity, severityText = severityWarn, "WARN"
+	}
+
+	// zero marks the time as unknown in OTLP
+	var t uint64
+	if !event.Timestamp.IsZero() {
+		t = uint64(event.Timestamp.UnixNano())
+	}
+
+	return record{
+		resource: resource,
+		log: logRecord{
+			TimeUnixNano:         t,
+			ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+			SeverityNumber:       severity,
+			SeverityText:         severityText,
+			Body:                 anyValue{StringValue: event.Message},
+			Attributes: []keyValue{
+				stringKeyValue("k8s.event.reason", event.Reason),
+				stringKeyValue("k8s.event.type", event.Type),
+				stringKeyValue("k8s.object.kind", event.Kind),
+				stringKeyValue("k8s.object.name", event.Name),
+			},
+		},
+	}
+}
+
+// toRequest groups the batch's log records
+// by the resource they were logged by.
+func toRequest(batch []record) *exportLogsServiceRequest {
+	req := &exportLogsServiceRequest{}
+	index := make(map[string]int)
+
+	for _, r := range batch {
+		key := resourceKey(r.resource)
+
+		i, ok := index[key]
+		if !ok {
+			i = len(req.ResourceLogs)
+			index[key] = i
+			req.ResourceLogs = append(req.ResourceLogs, resourceLogs{
+				Resource:  resource{Attributes: r.resource},
+				ScopeLogs: []scopeLogs{{Scope: scope{Name: scopeName}}},
+			})
+		}
+
+		sl := &req.ResourceLogs[i].ScopeLogs[0]
+		sl.LogRecords = append(sl.LogRecords, r.log)
+	}
+
+	return req
+}
+
+func (o *otlp) export(batch []record) {
+	if len(batch) == 0 {
+		return
+	}
+
+	body, contentType, err := o.encode(toRequest(batch))
+	if err != nil {
+		o.errChannel <- err
+		return
+	}
+
+	req, err := http.NewRequest("POST", o.url, bytes.NewReader(body))
+	if err != nil {
+		o.errChannel <- err
+		return
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range o.headers {
+		req.Header.Set(k, v)
+	}
+
+	_, err = utils.Do(req, o.client)
+	if err != nil {
+		o.errChannel <- err
+	}
+}
+
+func (o *otlp) encode(req *exportLogsServiceRequest) ([]byte, string, error) {
+	if o.encoding == EncodingJSON {
+		b, err := json.Marshal(req)
+		return b, "application/json", err
+	}
+	return req.marshalProto(), "application/x-protobuf", nil
+}
+
+// Close closes the injected channels. Anything
+// already on the stack will get exported.
+func (o *otlp) Close() {
+	if o.logChannel != nil {
+		close(o.logChannel)
+	}
+
+	if o.eventChannel != nil {
+		close(o.eventChannel)
+	}
+}
@@ -0,0 +1,206 @@
+package otlp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// messages returns the length-delimited
+// fields numbered num in a protobuf message.
+func messages(t *testing.T, b []byte, num protowire.Number) [][]byte {
+	found := [][]byte{}
+	for len(b) > 0 {
+		n, typ, l := protowire.ConsumeTag(b)
+		assert.GreaterOrEqual(t, l, 0)
+		b = b[l:]
+
+		if typ == protowire.BytesType {
+			v, l := protowire.ConsumeBytes(b)
+			if n == num {
+				found = append(found, v)
+			}
+			b = b[l:]
+			continue
+		}
+
+		l = protowire.ConsumeFieldValue(n, typ, b)
+		assert.GreaterOrEqual(t, l, 0)
+		b = b[l:]
+	}
+	return found
+}
+
+// receiver imitates an OTLP/HTTP collector,
+// keeping the bodies of the requests it gets.
+type receiver struct {
+	mutex        sync.Mutex
+	contentTypes []string
+	bodies       [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if req.URL.Path != "/v1/logs" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	b, _ := ioutil.ReadAll(req.Body)
+	r.contentTypes = append(r.contentTypes, req.Header.Get("Content-Type"))
+	r.bodies = append(r.bodies, b)
+}
+
+func Test_Build(t *testing.T) {
+	cli := &http.Client{}
+	ch := make(chan backend.RawLog)
+
+	o := New().Client(cli).LogChannel(ch).Url("http://collector:4318/").Cluster("hello").Build()
+
+	assert.NotNil(t, o)
+	assert.Equal(t, "http://collector:4318/v1/logs", o.url)
+	assert.Equal(t, ch, o.logChannel)
+	assert.Equal(t, "hello", o.cluster)
+	assert.Equal(t, EncodingProtobuf, o.encoding)
+	assert.Equal(t, DefaultBatchSize, o.batchSize)
+	assert.Equal(t, DefaultFlushInterval, o.flushInterval)
+}
+
+func Test_parseSeverity(t *testing.T) {
+	tests := map[string]struct {
+		number int32
+		text   string
+	}{
+		`{"level":"error","msg":"hello"}`:      {severityError, "ERROR"},
+		`time=2023-10-01 level=warn msg=hello`: {severityWarn, "WARN"},
+		`INFO starting server`:                 {severityInfo, "INFO"},
+		`[debug] hello`:                        {severityDebug, "DEBUG"},
+		`hello world`:                          {0, ""},
+		`an error happened`:                    {0, ""},
+	}
+
+	for line, expected := range tests {
+		number, text := parseSeverity(line)
+		assert.Equal(t, expected.number, number, line)
+		assert.Equal(t, expected.text, text, line)
+	}
+}
+
+func Test_toRequest(t *testing.T) {
+	o := New().Cluster("hello-cluster").Build()
+
+	metadata := map[string]string{"namespace": "hello", "pod": "world", "app": "admiral"}
+	batch := []record{
+		o.rawLogToRecord(backend.RawLog{Log: "ERROR first", Metadata: metadata, Timestamp: "1696118400000000000"}),
+		o.rawLogToRecord(backend.RawLog{Log: "second", Metadata: metadata, Timestamp: "1696118400000000001"}),
+		o.eventToRecord(backend.Event{Cluster: "hello-cluster", Reason: "NodeNotReady", Type: "Warning", Message: "some event"}),
+	}
+
+	req := toRequest(batch)
+	assert.Len(t, req.ResourceLogs, 2)
+	assert.Equal(t, []keyValue{
+		stringKeyValue("k8s.cluster.name", "hello-cluster"),
+		stringKeyValue("k8s.namespace.name", "hello"),
+		stringKeyValue("k8s.pod.label.app", "admiral"),
+		stringKeyValue("k8s.pod.name", "world"),
+	}, req.ResourceLogs[0].Resource.Attributes)
+
+	records := req.ResourceLogs[0].ScopeLogs[0].LogRecords
+	assert.Len(t, records, 2)
+	assert.Equal(t, uint64(1696118400000000000), records[0].TimeUnixNano)
+	assert.Equal(t, severityError, records[0].SeverityNumber)
+	assert.Equal(t, "second", records[1].Body.StringValue)
+
+	event := req.ResourceLogs[1].ScopeLogs[0].LogRecords[0]
+	assert.Equal(t, severityWarn, event.SeverityNumber)
+	assert.Contains(t, event.Attributes, stringKeyValue("k8s.event.reason", "NodeNotReady"))
+
+	b, err := json.Marshal(req)
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `"timeUnixNano":"1696118400000000000"`)
+	assert.Contains(t, string(b), `"body":{"stringValue":"ERROR first"}`)
+	assert.Contains(t, string(b), `"scope":{"name":"admiral"}`)
+}
+
+func Test_marshalProto(t *testing.T) {
+	kv := stringKeyValue("a", "b")
+	assert.Equal(t, []byte{0x0a, 0x01, 'a', 0x12, 0x03, 0x0a, 0x01, 'b'}, kv.marshalProto())
+
+	o := New().Build()
+	req := toRequest([]record{o.rawLogToRecord(backend.RawLog{Log: "some log", Metadata: map[string]string{"pod": "world"}})})
+	b := req.marshalProto()
+
+	rl := messages(t, b, 1)
+	assert.Len(t, rl, 1)
+
+	pod := stringKeyValue("k8s.pod.name", "world")
+	attributes := messages(t, messages(t, rl[0], 1)[0], 1)
+	assert.Equal(t, pod.marshalProto(), attributes[0])
+
+	sl := messages(t, rl[0], 2)
+	assert.Equal(t, (&scope{Name: scopeName}).marshalProto(), messages(t, sl[0], 1)[0])
+
+	lr := messages(t, sl[0], 2)
+	assert.Len(t, lr, 1)
+	assert.Equal(t, (&anyValue{StringValue: "some log"}).marshalProto(), messages(t, lr[0], 5)[0])
+}
+
+func Test_Stream(t *testing.T) {
+	for _, encoding := range []string{EncodingProtobuf, EncodingJSON} {
+		r := &receiver{}
+		server := httptest.NewServer(r)
+
+		ch := make(chan backend.RawLog, 3)
+		errCh := make(chan error, 1)
+
+		o := New().Client(&http.Client{}).Url(server.URL).Encoding(encoding).Batch(2, time.Hour).LogChannel(ch).ErrChannel(errCh).Build()
+
+		ch <- backend.RawLog{Log: "some log"}
+		ch <- backend.RawLog{Log: "other log"}
+		ch <- backend.RawLog{Log: "last log"}
+		o.Close()
+		o.Stream()
+
+		assert.Empty(t, errCh)
+		assert.Len(t, r.bodies, 2)
+
+		if encoding == EncodingJSON {
+			assert.Equal(t, "application/json", r.contentTypes[0])
+			req := exportLogsServiceRequest{}
+			assert.Nil(t, json.Unmarshal(r.bodies[0], &req))
+			assert.Len(t, req.ResourceLogs[0].ScopeLogs[0].LogRecords, 2)
+			continue
+		}
+
+		assert.Equal(t, "application/x-protobuf", r.contentTypes[0])
+		assert.Len(t, messages(t, r.bodies[0], 1), 1)
+	}
+}
+
+func Test_StreamErr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid request"))
+	}))
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	o := New().Client(&http.Client{}).Url(server.URL).LogChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- backend.RawLog{Log: "some log"}
+	o.Close()
+	o.Stream()
+
+	assert.Contains(t, (<-errCh).Error(), "invalid request")
+}
@@ -0,0 +1,47 @@
+package otlp
+
+import (
+	"regexp"
+	"strings"
+)
+
+// OTLP severity numbers, at the start of each range.
+const (
+	severityTrace int32 = 1
+	severityDebug int32 = 5
+	severityInfo  int32 = 9
+	severityWarn  int32 = 13
+	severityError int32 = 17
+	severityFatal int32 = 21
+)
+
+var severities = map[string]int32{
+	"trace":    severityTrace,
+	"debug":    severityDebug,
+	"info":     severityInfo,
+	"notice":   severityInfo,
+	"warn":     severityWarn,
+	"warning":  severityWarn,
+	"error":    severityError,
+	"err":      severityError,
+	"critical": severityFatal,
+	"fatal":    severityFatal,
+	"panic":    severityFatal,
+}
+
+// levelPattern finds the level of a line logged as JSON
+// ("level":"info"), logfmt (level=info) or plain text
+// starting with the level ("INFO ...", "[info] ...").
+var levelPattern = regexp.MustCompile(`(?i)(?:"(?:level|severity|lvl)"\s*:\s*"|\b(?:level|severity|lvl)=|^\W*)(trace|debug|info|notice|warn|warning|error|err|critical|fatal|panic)\b`)
+
+// parseSeverity returns the OTLP severity number and text
+// of the line, or zero values if no level can be found.
+func parseSeverity(line string) (int32, string) {
+	match := levelPattern.FindStringSubmatch(line)
+	if match == nil {
+		return 0, ""
+	}
+
+	level := strings.ToLower(match[1])
+	return severities[level], strings.ToUpper(level)
+}
@@ -0,0 +1,255 @@
+package pagerduty
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/phil-inc/admiral/pkg/utils"
+)
+
+const (
+	// DefaultURL is the Events API v2 endpoint.
+	DefaultURL = "https://events.pagerduty.com/v2/enqueue"
+
+	// maxRetries is how many times a rate-limited
+	// event is retried before it is dropped.
+	maxRetries = 3
+
+	// maxSummaryLength is the longest summary, in
+	// characters, PagerDuty accepts on an incident.
+	maxSummaryLength = 1024
+
+	// DefaultSeverity is the severity problems are
+	// triggered with when their type has none.
+	DefaultSeverity = "error"
+
+	actionTrigger = "trigger"
+	actionResolve = "resolve"
+)
+
+// DefaultSeverities maps event types to the PagerDuty severity
+// they trigger incidents with. Normal events trigger none,
+// unless their reason is the problem of a recovery.
+var DefaultSeverities = map[string]string{
+	"Warning": "critical",
+}
+
+type Builder struct {
+	url          string
+	client       *http.Client
+	eventChannel chan backend.Event
+	errChannel   chan error
+	routingKey   string
+	severities   map[string]string
+	recoveries   map[string][]string
+	problems     map[string]bool
+}
+
+// New returns a builder for the pagerduty struct.
+func New() *Builder {
+	return &Builder{
+		recoveries: make(map[string][]string),
+		problems:   make(map[string]bool),
+	}
+}
+
+// Url sets the Events API url, defaulting to DefaultURL.
+func (b *Builder) Url(url string) *Builder {
+	b.url = url
+	return b
+}
+
+// EventChannel sets the channel from where
+// pagerduty will take events.
+func (b *Builder) EventChannel(eventChannel chan backend.Event) *Builder {
+	b.eventChannel = eventChannel
+	return b
+}
+
+// ErrChannel sets the channel where pagerduty
+// will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// Client sets the HTTP client.
+func (b *Builder) Client(client *http.Client) *Builder {
+	b.client = client
+	return b
+}
+
+// RoutingKey sets the integration key of the
+// PagerDuty service that incidents are opened on.
+func (b *Builder) RoutingKey(routingKey string) *Builder {
+	b.routingKey = routingKey
+	return b
+}
+
+// Severities maps event types to PagerDuty severities,
+// replacing DefaultSeverities for the types it sets, where
+// an empty severity turns a type off. Events of types
+// without a severity are skipped, but for problems.
+func (b *Builder) Severities(severities map[string]string) *Builder {
+	b.severities = severities
+	return b
+}
+
+// Recovery pairs a problem reason with the reason that
+// resolves it, e.g. NodeNotReady with NodeReady. Problems
+// always trigger, with DefaultSeverity when their type
+// has no severity.
+func (b *Builder) Recovery(problem string, recovery string) *Builder {
+	b.recoveries[recovery] = append(b.recoveries[recovery], problem)
+	b.problems[problem] = true
+	return b
+}
+
+// Build returns a configured pagerduty struct.
+func (b *Builder) Build() *pagerduty {
+	url := b.url
+	if url == "" {
+		url = DefaultURL
+	}
+
+	severities := make(map[string]string)
+	for k, v := range DefaultSeverities {
+		severities[k] = v
+	}
+	for k, v := range b.severities {
+		if v == "" {
+			delete(severities, k)
+			continue
+		}
+		severities[k] = v
+	}
+
+	return &pagerduty{
+		url:          url,
+		client:       b.client,
+		eventChannel: b.eventChannel,
+		errChannel:   b.errChannel,
+		routingKey:   b.routingKey,
+		severities:   severities,
+		recoveries:   b.recoveries,
+		problems:     b.problems,
+	}
+}
+
+type pagerduty struct {
+	url          string
+	client       *http.Client
+	eventChannel chan backend.Event
+	errChannel   chan error
+	routingKey   string
+	severities   map[string]string
+	recoveries   map[string][]string
+	problems     map[string]bool
+}
+
+type pagerdutyDTO struct {
+	RoutingKey  string   `json:"routing_key"`
+	EventAction string   `json:"event_action"`
+	DedupKey    string   `json:"dedup_key"`
+	Payload     *payload `json:"payload,omitempty"`
+}
+
+type payload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// Stream waits to receive something on eventChannel, then
+// triggers an incident, or resolves the incidents the
+// event is a recovery from. Events of types without a
+// severity trigger nothing, unless they are problems.
+func (p *pagerduty) Stream() {
+	for event := range p.eventChannel {
+		for _, dto := range p.eventToDTOs(event) {
+			err := utils.SendWithRetry(dto, "POST", p.url, nil, p.client, maxRetries)
+			if err != nil {
+				p.errChannel <- err
+			}
+		}
+	}
+}
+
+func (p *pagerduty) eventToDTOs(event backend.Event) []*pagerdutyDTO {
+	if problems, ok := p.recoveries[event.Reason]; ok {
+		dtos := []*pagerdutyDTO{}
+		for _, problem := range problems {
+			dtos = append(dtos, &pagerdutyDTO{
+				RoutingKey:  p.routingKey,
+				EventAction: actionResolve,
+				DedupKey:    dedupKey(event, problem),
+			})
+		}
+		return dtos
+	}
+
+	severity, ok := p.severities[event.Type]
+	if !ok {
+		if !p.problems[event.Reason] {
+			return nil
+		}
+		severity = DefaultSeverity
+	}
+
+	timestamp := ""
+	if !event.Timestamp.IsZero() {
+		timestamp = event.Timestamp.Format(time.RFC3339)
+	}
+
+	summary := fmt.Sprintf("%s: %s %s/%s: %s", event.Cluster, event.Reason, strings.ToLower(event.Kind), event.Name, event.Message)
+	if r := []rune(summary); len(r) > maxSummaryLength {
+		summary = string(r[:maxSummaryLength])
+	}
+
+	return []*pagerdutyDTO{
+		{
+			RoutingKey:  p.routingKey,
+			EventAction: actionTrigger,
+			DedupKey:    dedupKey(event, event.Reason),
+			Payload: &payload{
+				Summary:   summary,
+				Source:    event.Cluster,
+				Severity:  severity,
+				Timestamp: timestamp,
+				Component: event.Name,
+				Group:     event.Namespace,
+				Class:     event.Reason,
+				CustomDetails: map[string]string{
+					"cluster":   event.Cluster,
+					"namespace": event.Namespace,
+					"kind":      event.Kind,
+					"object":    event.Name,
+					"reason":    event.Reason,
+					"type":      event.Type,
+					"message":   event.Message,
+				},
+			},
+		},
+	}
+}
+
+// dedupKey identifies the incident of an involved object
+// having a problem, so triggers for it are grouped and a
+// recovery can resolve it.
+func dedupKey(event backend.Event, reason string) string {
+	return strings.Join([]string{event.Cluster, event.Namespace, event.Kind, event.Name, reason}, "/")
+}
+
+// Close closes the eventChannel. Anything
+// already on the stack will get processed.
+func (p *pagerduty) Close() {
+	close(p.eventChannel)
+}
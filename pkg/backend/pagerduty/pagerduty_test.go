@@ -0,0 +1,144 @@
+package pagerduty
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+var mocked_event = backend.Event{
+	Cluster: "hello-cluster",
+	Kind:    "Node",
+	Name:    "hello-node",
+	Reason:  "NodeNotReady",
+	Type:    "Normal",
+	Message: "Node is not ready",
+}
+
+func Test_Build(t *testing.T) {
+	cli := &http.Client{}
+	ch := make(chan backend.Event)
+
+	p := New().Client(cli).EventChannel(ch).RoutingKey("key").Severities(map[string]string{"Normal": "warning", "Warning": ""}).Build()
+
+	assert.NotNil(t, p)
+	assert.Equal(t, DefaultURL, p.url)
+	assert.Equal(t, "key", p.routingKey)
+	assert.Equal(t, ch, p.eventChannel)
+	assert.Equal(t, "warning", p.severities["Normal"])
+	assert.NotContains(t, p.severities, "Warning")
+}
+
+func Test_eventToDTOs(t *testing.T) {
+	p := New().RoutingKey("key").Recovery("NodeNotReady", "NodeReady").Build()
+
+	trigger := p.eventToDTOs(mocked_event)
+	assert.Len(t, trigger, 1)
+	assert.Equal(t, "key", trigger[0].RoutingKey)
+	assert.Equal(t, actionTrigger, trigger[0].EventAction)
+	assert.Equal(t, "hello-cluster//Node/hello-node/NodeNotReady", trigger[0].DedupKey)
+	assert.Equal(t, DefaultSeverity, trigger[0].Payload.Severity)
+	assert.Equal(t, "hello-cluster: NodeNotReady node/hello-node: Node is not ready", trigger[0].Payload.Summary)
+	assert.Empty(t, trigger[0].Payload.Timestamp)
+
+	recovery := mocked_event
+	recovery.Reason = "NodeReady"
+	recovery.Type = "Normal"
+
+	resolve := p.eventToDTOs(recovery)
+	assert.Len(t, resolve, 1)
+	assert.Equal(t, actionResolve, resolve[0].EventAction)
+	assert.Equal(t, trigger[0].DedupKey, resolve[0].DedupKey)
+	assert.Nil(t, resolve[0].Payload)
+
+	// long summaries are cut between characters
+	long := mocked_event
+	long.Message = strings.Repeat("é", maxSummaryLength)
+	summary := p.eventToDTOs(long)[0].Payload.Summary
+	assert.True(t, utf8.ValidString(summary))
+	assert.Equal(t, maxSummaryLength, utf8.RuneCountInString(summary))
+
+	// other normal events trigger nothing unless given a severity
+	normal := mocked_event
+	normal.Reason = "Pulled"
+	assert.Empty(t, p.eventToDTOs(normal))
+
+	p = New().RoutingKey("key").Severities(map[string]string{"Normal": "info"}).Build()
+	trigger = p.eventToDTOs(normal)
+	assert.Len(t, trigger, 1)
+	assert.Equal(t, "info", trigger[0].Payload.Severity)
+
+	// warnings trigger critical incidents unless turned off
+	warning := mocked_event
+	warning.Reason = "BackOff"
+	warning.Type = "Warning"
+	assert.Equal(t, "critical", p.eventToDTOs(warning)[0].Payload.Severity)
+
+	p = New().RoutingKey("key").Severities(map[string]string{"Warning": ""}).Build()
+	assert.Empty(t, p.eventToDTOs(warning))
+}
+
+func Test_Stream(t *testing.T) {
+	var mutex sync.Mutex
+	actions := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		b, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+
+		dto := pagerdutyDTO{}
+		assert.Nil(t, json.Unmarshal(b, &dto))
+
+		mutex.Lock()
+		actions = append(actions, dto.EventAction)
+		mutex.Unlock()
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	ch := make(chan backend.Event, 2)
+	errCh := make(chan error, 2)
+
+	p := New().Client(&http.Client{}).Url(server.URL).RoutingKey("key").Recovery("NodeNotReady", "NodeReady").EventChannel(ch).ErrChannel(errCh).Build()
+
+	recovery := mocked_event
+	recovery.Reason = "NodeReady"
+
+	ch <- mocked_event
+	ch <- recovery
+	p.Close()
+	p.Stream()
+
+	assert.Empty(t, errCh)
+	assert.Equal(t, []string{actionTrigger, actionResolve}, actions)
+}
+
+func Test_StreamErr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status":"invalid event"}`))
+	}))
+
+	cli := &http.Client{}
+	ch := make(chan backend.Event, 1)
+	errCh := make(chan error, 1)
+
+	p := New().ErrChannel(errCh).Url(server.URL).Client(cli).Recovery("NodeNotReady", "NodeReady").EventChannel(ch).Build()
+
+	p.eventChannel <- mocked_event
+	p.Close()
+	p.Stream()
+
+	err := <-errCh
+	assert.Equal(t, "400 Bad Request - {\"status\":\"invalid event\"}", err.Error())
+}
@@ -0,0 +1,277 @@
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultLogKey   = "admiral:{{.cluster}}:logs:{{.namespace}}"
+	DefaultEventKey = "admiral:{{.cluster}}:events"
+	DefaultMaxLen   = 10000
+
+	// maxRetries is how many times a command is sent
+	// again after a network error, on a new connection.
+	maxRetries = 3
+)
+
+type Builder struct {
+	address      string
+	db           int
+	tlsConfig    *tls.Config
+	username     string
+	password     string
+	cluster      string
+	logChannel   chan backend.RawLog
+	eventChannel chan backend.Event
+	errChannel   chan error
+	logKey       *template.Template
+	eventKey     *template.Template
+	maxLen       int64
+}
+
+// New returns a builder for the redis struct.
+func New() *Builder {
+	return &Builder{
+		logKey:   template.Must(template.New("key").Option("missingkey=zero").Parse(DefaultLogKey)),
+		eventKey: template.Must(template.New("key").Option("missingkey=zero").Parse(DefaultEventKey)),
+		maxLen:   DefaultMaxLen,
+	}
+}
+
+// Address sets the host:port of the redis server.
+func (b *Builder) Address(address string) *Builder {
+	b.address = address
+	return b
+}
+
+// DB selects the database of the streams.
+func (b *Builder) DB(db int) *Builder {
+	b.db = db
+	return b
+}
+
+// TLSConfig enables TLS on the connections.
+func (b *Builder) TLSConfig(tlsConfig *tls.Config) *Builder {
+	b.tlsConfig = tlsConfig
+	return b
+}
+
+// Auth authenticates the connections, the username
+// being empty outside of Redis ACLs.
+func (b *Builder) Auth(username, password string) *Builder {
+	b.username = username
+	b.password = password
+	return b
+}
+
+// Cluster sets the cluster name logs
+// are written with in their key.
+func (b *Builder) Cluster(cluster string) *Builder {
+	b.cluster = cluster
+	return b
+}
+
+// LogChannel sets the channel from where
+// redis will take logs.
+func (b *Builder) LogChannel(logChannel chan backend.RawLog) *Builder {
+	b.logChannel = logChannel
+	return b
+}
+
+// EventChannel sets the channel from where
+// redis will take events.
+func (b *Builder) EventChannel(eventChannel chan backend.Event) *Builder {
+	b.eventChannel = eventChannel
+	return b
+}
+
+// ErrChannel sets the channel where redis
+// will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// Key sets the template rendering the stream key
+// of a log from its labels and the cluster, or of
+// an event from its fields, replacing DefaultLogKey
+// and DefaultEventKey.
+func (b *Builder) Key(key *template.Template) *Builder {
+	b.logKey = key
+	b.eventKey = key
+	return b
+}
+
+// MaxLen trims streams to about maxLen entries,
+// or never when it is negative.
+func (b *Builder) MaxLen(maxLen int64) *Builder {
+	b.maxLen = maxLen
+	return b
+}
+
+// Build returns a configured redis struct.
+func (b *Builder) Build() *redis {
+	maxLen := b.maxLen
+	if maxLen < 0 {
+		maxLen = 0
+	}
+
+	// the client reconnects by itself, retrying
+	// commands which failed on a broken connection
+	client := goredis.NewClient(&goredis.Options{
+		Addr:            b.address,
+		DB:              b.db,
+		Username:        b.username,
+		Password:        b.password,
+		TLSConfig:       b.tlsConfig,
+		MaxRetries:      maxRetries,
+		DisableIdentity: true,
+	})
+
+	return &redis{
+		client:       client,
+		cluster:      b.cluster,
+		logChannel:   b.logChannel,
+		eventChannel: b.eventChannel,
+		errChannel:   b.errChannel,
+		logKey:       b.logKey,
+		eventKey:     b.eventKey,
+		maxLen:       maxLen,
+	}
+}
+
+type redis struct {
+	client       *goredis.Client
+	cluster      string
+	logChannel   chan backend.RawLog
+	eventChannel chan backend.Event
+	errChannel   chan error
+	logKey       *template.Template
+	eventKey     *template.Template
+	maxLen       int64
+}
+
+// Stream adds whatever is received on logChannel and
+// eventChannel to their streams, until both are closed.
+func (r *redis) Stream() {
+	defer r.client.Close()
+
+	logChannel, eventChannel := r.logChannel, r.eventChannel
+
+	for logChannel != nil || eventChannel != nil {
+		select {
+		case raw, ok := <-logChannel:
+			if !ok {
+				logChannel = nil
+				continue
+			}
+			r.addLog(raw)
+
+		case event, ok := <-eventChannel:
+			if !ok {
+				eventChannel = nil
+				continue
+			}
+			r.addEvent(event)
+		}
+	}
+}
+
+// addLog adds the log with its labels
+// encoded as JSON in a single field.
+func (r *redis) addLog(raw backend.RawLog) {
+	data := map[string]string{"cluster": r.cluster}
+	for k, v := range raw.Metadata {
+		data[k] = v
+	}
+
+	key, err := r.renderKey(r.logKey, data)
+	if err != nil {
+		r.errChannel <- err
+		return
+	}
+
+	t := time.Now()
+	if ns, err := strconv.ParseInt(raw.Timestamp, 10, 64); err == nil {
+		t = time.Unix(0, ns)
+	}
+
+	labels, err := json.Marshal(raw.Metadata)
+	if err != nil {
+		r.errChannel <- err
+		return
+	}
+
+	r.add(key, []string{
+		"timestamp", t.Format(time.RFC3339Nano),
+		"log", raw.Log,
+		"labels", string(labels),
+	})
+}
+
+// addEvent adds the event with
+// a field for each of its fields.
+func (r *redis) addEvent(e backend.Event) {
+	data := e.Fields()
+	values := []string{}
+	for _, name := range backend.FieldNames {
+		values = append(values, name, data[name])
+	}
+
+	key, err := r.renderKey(r.eventKey, data)
+	if err != nil {
+		r.errChannel <- err
+		return
+	}
+
+	r.add(key, values)
+}
+
+func (r *redis) renderKey(key *template.Template, data map[string]string) (string, error) {
+	var buf strings.Builder
+	if err := key.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	if buf.Len() == 0 {
+		return "", fmt.Errorf("redis: empty key for %v", data)
+	}
+	return buf.String(), nil
+}
+
+// add sends XADD, trimming the stream with MAXLEN ~
+// so that whole macro nodes are evicted at once.
+func (r *redis) add(key string, values []string) {
+	err := r.client.XAdd(context.Background(), &goredis.XAddArgs{
+		Stream: key,
+		MaxLen: r.maxLen,
+		Approx: r.maxLen > 0,
+		Values: values,
+	}).Err()
+
+	if err != nil {
+		r.errChannel <- fmt.Errorf("redis: dropped an entry of %s: %w", key, err)
+	}
+}
+
+// Close closes the injected channels. Anything
+// already on the stack will get added.
+func (r *redis) Close() {
+	if r.logChannel != nil {
+		close(r.logChannel)
+	}
+
+	if r.eventChannel != nil {
+		close(r.eventChannel)
+	}
+}
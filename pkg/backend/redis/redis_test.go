@@ -0,0 +1,140 @@
+package redis
+
+import (
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Build(t *testing.T) {
+	ch := make(chan backend.RawLog)
+	events := make(chan backend.Event)
+	errCh := make(chan error)
+	key := template.Must(template.New("key").Parse("admiral:{{.namespace}}"))
+
+	r := New().Address("127.0.0.1:6379").DB(2).Auth("", "secret").Cluster("test").Key(key).LogChannel(ch).EventChannel(events).ErrChannel(errCh).Build()
+
+	assert.Equal(t, "127.0.0.1:6379", r.client.Options().Addr)
+	assert.Equal(t, 2, r.client.Options().DB)
+	assert.Equal(t, "secret", r.client.Options().Password)
+	assert.Equal(t, "test", r.cluster)
+	assert.Equal(t, key, r.logKey)
+	assert.Equal(t, key, r.eventKey)
+	assert.Equal(t, ch, r.logChannel)
+	assert.Equal(t, events, r.eventChannel)
+	assert.Equal(t, errCh, r.errChannel)
+	assert.Equal(t, int64(DefaultMaxLen), r.maxLen)
+
+	assert.Equal(t, int64(0), New().MaxLen(-1).Build().maxLen)
+}
+
+func Test_Stream(t *testing.T) {
+	m := miniredis.RunT(t)
+	m.RequireAuth("secret")
+
+	ch := make(chan backend.RawLog, 1)
+	events := make(chan backend.Event, 1)
+	errCh := make(chan error, 1)
+
+	r := New().Address(m.Addr()).Auth("", "secret").Cluster("test").LogChannel(ch).EventChannel(events).ErrChannel(errCh).Build()
+
+	ch <- backend.RawLog{Log: "some log", Timestamp: "1696118400000000000", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	events <- backend.Event{Cluster: "test", Namespace: "hello", Kind: "Pod", Name: "world", Reason: "BackOff", Type: "Warning", Message: "Back-off restarting failed container"}
+	r.Close()
+	r.Stream()
+
+	assert.Empty(t, errCh)
+
+	logs, err := m.Stream("admiral:test:logs:hello")
+	assert.Nil(t, err)
+	assert.Len(t, logs, 1)
+	assert.Equal(t, []string{"timestamp", time.Unix(0, 1696118400000000000).Format(time.RFC3339Nano), "log", "some log", "labels", `{"namespace":"hello","pod":"world"}`}, logs[0].Values)
+
+	entries, err := m.Stream("admiral:test:events")
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, []string{"cluster", "test", "namespace", "hello", "kind", "Pod", "object", "world", "reason", "BackOff", "type", "Warning", "message", "Back-off restarting failed container", "timestamp", "0001-01-01T00:00:00Z"}, entries[0].Values)
+}
+
+func Test_StreamMaxLen(t *testing.T) {
+	m := miniredis.RunT(t)
+
+	ch := make(chan backend.RawLog, 3)
+	errCh := make(chan error, 1)
+
+	key := template.Must(template.New("key").Parse("admiral:{{.pod}}"))
+	r := New().Address(m.Addr()).Key(key).MaxLen(2).LogChannel(ch).ErrChannel(errCh).Build()
+
+	for _, log := range []string{"first", "second", "third"} {
+		ch <- backend.RawLog{Log: log, Metadata: map[string]string{"pod": "world"}}
+	}
+	r.Close()
+	r.Stream()
+
+	assert.Empty(t, errCh)
+
+	entries, err := m.Stream("admiral:world")
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "third", entries[1].Values[3])
+}
+
+func Test_StreamReconnect(t *testing.T) {
+	m := miniredis.RunT(t)
+
+	ch := make(chan backend.RawLog)
+	errCh := make(chan error, 1)
+
+	key := template.Must(template.New("key").Parse("admiral:{{.pod}}"))
+	r := New().Address(m.Addr()).Key(key).MaxLen(-1).LogChannel(ch).ErrChannel(errCh).Build()
+
+	done := make(chan struct{})
+	go func() {
+		r.Stream()
+		close(done)
+	}()
+
+	ch <- backend.RawLog{Log: "first", Metadata: map[string]string{"pod": "world"}}
+	assert.Eventually(t, func() bool {
+		entries, _ := m.Stream("admiral:world")
+		return len(entries) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the pooled connection breaks with the restart
+	m.Close()
+	assert.Nil(t, m.Restart())
+
+	ch <- backend.RawLog{Log: "second", Metadata: map[string]string{"pod": "world"}}
+	r.Close()
+	<-done
+
+	assert.Empty(t, errCh)
+	entries, err := m.Stream("admiral:world")
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, []string{"log", "second"}, entries[1].Values[2:4])
+}
+
+func Test_StreamErr(t *testing.T) {
+	m := miniredis.RunT(t)
+	m.RequireAuth("secret")
+
+	ch := make(chan backend.RawLog, 2)
+	errCh := make(chan error, 2)
+
+	key := template.Must(template.New("key").Option("missingkey=zero").Parse("{{.pod}}"))
+	r := New().Address(m.Addr()).Auth("", "invalid").Key(key).LogChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- backend.RawLog{Log: "some log", Metadata: map[string]string{"namespace": "hello"}}
+	ch <- backend.RawLog{Log: "some log", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	r.Close()
+	r.Stream()
+
+	assert.Equal(t, "redis: empty key for map[cluster: namespace:hello]", (<-errCh).Error())
+	assert.Contains(t, (<-errCh).Error(), "redis: dropped an entry of world: WRONGPASS")
+	assert.Empty(t, m.Keys())
+}
@@ -0,0 +1,453 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/phil-inc/admiral/pkg/utils"
+)
+
+const (
+	DefaultRegion   = "us-east-1"
+	DefaultMaxSize  = 64 << 20
+	DefaultMaxAge   = 5 * time.Minute
+	DefaultPartSize = 16 << 20
+
+	// minPartSize is the smallest part S3
+	// accepts, other than the last one.
+	minPartSize = 5 << 20
+
+	objectSuffix = ".json.gz"
+
+	uploadTimeFormat = "20060102T150405.000Z"
+
+	// maxRetries is how many times a
+	// failed upload is attempted again.
+	maxRetries = 3
+)
+
+type Builder struct {
+	url         string
+	client      *http.Client
+	logChannel  chan backend.RawLog
+	errChannel  chan error
+	bucket      string
+	cluster     string
+	credentials credentials
+	maxSize     int
+	maxAge      time.Duration
+	partSize    int
+}
+
+// New returns a builder for the s3 struct.
+func New() *Builder {
+	return &Builder{}
+}
+
+// Url sets the url of the S3-compatible endpoint.
+func (b *Builder) Url(url string) *Builder {
+	b.url = url
+	return b
+}
+
+// LogChannel sets the channel from where
+// s3 will take logs.
+func (b *Builder) LogChannel(logChannel chan backend.RawLog) *Builder {
+	b.logChannel = logChannel
+	return b
+}
+
+// ErrChannel sets the channel where s3
+// will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// Client sets the HTTP client.
+func (b *Builder) Client(client *http.Client) *Builder {
+	b.client = client
+	return b
+}
+
+// Bucket sets the bucket objects are uploaded to.
+func (b *Builder) Bucket(bucket string) *Builder {
+	b.bucket = bucket
+	return b
+}
+
+// Cluster sets the cluster name
+// objects keys start with.
+func (b *Builder) Cluster(cluster string) *Builder {
+	b.cluster = cluster
+	return b
+}
+
+// Credentials sets the keys requests are signed with,
+// the session token being only needed for temporary ones.
+func (b *Builder) Credentials(accessKey, secretKey, sessionToken string) *Builder {
+	b.credentials.accessKey = accessKey
+	b.credentials.secretKey = secretKey
+	b.credentials.sessionToken = sessionToken
+	return b
+}
+
+// Region sets the region requests are signed for.
+func (b *Builder) Region(region string) *Builder {
+	b.credentials.region = region
+	return b
+}
+
+// Flush sets how many bytes of logs an object holds
+// at most before compression, and how long they are
+// buffered before it is uploaded.
+func (b *Builder) Flush(maxSize int, maxAge time.Duration) *Builder {
+	b.maxSize = maxSize
+	b.maxAge = maxAge
+	return b
+}
+
+// PartSize sets the size of the parts of multipart
+// uploads, which objects larger than it are sent with.
+func (b *Builder) PartSize(partSize int) *Builder {
+	b.partSize = partSize
+	return b
+}
+
+// Build returns a configured s3 struct.
+func (b *Builder) Build() *s3 {
+	s := &s3{
+		url:         strings.TrimSuffix(b.url, "/"),
+		client:      b.client,
+		logChannel:  b.logChannel,
+		errChannel:  b.errChannel,
+		bucket:      b.bucket,
+		cluster:     b.cluster,
+		credentials: b.credentials,
+		maxSize:     b.maxSize,
+		maxAge:      b.maxAge,
+		partSize:    b.partSize,
+		backoff:     time.Second,
+		objects:     map[string]*object{},
+	}
+
+	if s.credentials.region == "" {
+		s.credentials.region = DefaultRegion
+	}
+	if s.maxSize <= 0 {
+		s.maxSize = DefaultMaxSize
+	}
+	if s.maxAge <= 0 {
+		s.maxAge = DefaultMaxAge
+	}
+	if s.partSize < minPartSize {
+		s.partSize = DefaultPartSize
+	}
+
+	// check often enough for objects
+	// to be uploaded close to maxAge
+	s.checkInterval = s.maxAge / 10
+	if s.checkInterval < time.Second {
+		s.checkInterval = time.Second
+	}
+
+	return s
+}
+
+type s3 struct {
+	url           string
+	client        *http.Client
+	logChannel    chan backend.RawLog
+	errChannel    chan error
+	bucket        string
+	cluster       string
+	credentials   credentials
+	maxSize       int
+	maxAge        time.Duration
+	partSize      int
+	backoff       time.Duration
+	checkInterval time.Duration
+	objects       map[string]*object
+}
+
+// object buffers the compressed logs
+// of one pod for one hour.
+type object struct {
+	buf     bytes.Buffer
+	gzip    *gzip.Writer
+	size    int
+	created time.Time
+}
+
+type record struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Log       string            `json:"log"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []part   `xml:"Part"`
+}
+
+type part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// errorResponse is the body of a failed request, which
+// CompleteMultipartUpload can return with a 200 status.
+type errorResponse struct {
+	XMLName xml.Name
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// Stream buffers logs into an object per pod and hour,
+// uploading objects once they reach maxSize, once they
+// are older than maxAge, and when logChannel is closed.
+func (s *s3) Stream() {
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case raw, ok := <-s.logChannel:
+			if !ok {
+				s.flush(func(*object) bool { return true })
+				return
+			}
+
+			if err := s.write(raw); err != nil {
+				s.errChannel <- err
+			}
+
+		case <-ticker.C:
+			s.flush(func(o *object) bool { return time.Since(o.created) >= s.maxAge })
+		}
+	}
+}
+
+func (s *s3) write(r backend.RawLog) error {
+	t := time.Now()
+	if ns, err := strconv.ParseInt(r.Timestamp, 10, 64); err == nil {
+		t = time.Unix(0, ns)
+	}
+
+	line, err := json.Marshal(record{Timestamp: t, Log: r.Log, Labels: r.Metadata})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	prefix := s.keyPrefix(r.Metadata, t)
+
+	o, ok := s.objects[prefix]
+	if !ok {
+		o = &object{created: time.Now()}
+		o.gzip = gzip.NewWriter(&o.buf)
+		s.objects[prefix] = o
+	}
+
+	if _, err := o.gzip.Write(line); err != nil {
+		return err
+	}
+	o.size += len(line)
+
+	if o.size >= s.maxSize {
+		delete(s.objects, prefix)
+		return s.upload(prefix, o)
+	}
+	return nil
+}
+
+// keyPrefix returns the key of the log's object
+// up to its hour, cluster/namespace/pod/YYYY/MM/DD/HH.
+func (s *s3) keyPrefix(labels map[string]string, t time.Time) string {
+	segments := []string{}
+	if s.cluster != "" {
+		segments = append(segments, s.cluster)
+	}
+	segments = append(segments, labels["namespace"], labels["pod"], t.UTC().Format("2006/01/02/15"))
+
+	return strings.Join(segments, "/")
+}
+
+func (s *s3) flush(due func(*object) bool) {
+	for prefix, o := range s.objects {
+		if !due(o) {
+			continue
+		}
+
+		delete(s.objects, prefix)
+		if err := s.upload(prefix, o); err != nil {
+			s.errChannel <- err
+		}
+	}
+}
+
+// upload sends the object under a key of its prefix
+// which no other upload takes, so that the bucket
+// needn't be listed, retrying failed uploads.
+func (s *s3) upload(prefix string, o *object) error {
+	if err := o.gzip.Close(); err != nil {
+		return err
+	}
+
+	key, err := objectKey(prefix, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		if o.buf.Len() > s.partSize {
+			err = s.putMultipart(key, o.buf.Bytes())
+		} else {
+			_, err = s.do("PUT", key, nil, o.buf.Bytes())
+		}
+
+		if err == nil {
+			return nil
+		}
+
+		if attempt == maxRetries {
+			return fmt.Errorf("s3: dropped the logs of %s after %d retries: %w", prefix, maxRetries, err)
+		}
+		time.Sleep(s.backoff * time.Duration(attempt+1))
+	}
+}
+
+// objectKey suffixes the prefix with the upload time
+// and random bytes, so that keys sort by upload and
+// don't collide across restarts or replicas.
+func objectKey(prefix string, t time.Time) (string, error) {
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return prefix + "-" + t.UTC().Format(uploadTimeFormat) + "-" + hex.EncodeToString(random) + objectSuffix, nil
+}
+
+// putMultipart uploads the object in parts of partSize,
+// aborting the upload if any of them, or its completion,
+// fails.
+func (s *s3) putMultipart(key string, body []byte) error {
+	res, err := s.do("POST", key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+
+	initiated := initiateMultipartUploadResult{}
+	if err := xml.Unmarshal(res.body, &initiated); err != nil {
+		return err
+	}
+	uploadID := initiated.UploadID
+
+	complete := completeMultipartUpload{}
+	for n := 0; n*s.partSize < len(body); n++ {
+		end := (n + 1) * s.partSize
+		if end > len(body) {
+			end = len(body)
+		}
+
+		query := url.Values{"partNumber": {strconv.Itoa(n + 1)}, "uploadId": {uploadID}}
+		res, err := s.do("PUT", key, query, body[n*s.partSize:end])
+		if err != nil {
+			s.do("DELETE", key, url.Values{"uploadId": {uploadID}}, nil)
+			return err
+		}
+
+		complete.Parts = append(complete.Parts, part{PartNumber: n + 1, ETag: res.header.Get("ETag")})
+	}
+
+	payload, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+
+	// the upload can fail after a 200
+	// status, with an error in the body
+	res, err = s.do("POST", key, url.Values{"uploadId": {uploadID}}, payload)
+	if err == nil {
+		failed := errorResponse{}
+		if xml.Unmarshal(res.body, &failed) == nil && failed.XMLName.Local == "Error" {
+			err = fmt.Errorf("s3: completing the upload of %s: %s: %s", key, failed.Code, failed.Message)
+		}
+	}
+
+	if err != nil {
+		s.do("DELETE", key, url.Values{"uploadId": {uploadID}}, nil)
+	}
+	return err
+}
+
+type response struct {
+	header http.Header
+	body   []byte
+}
+
+// do sends a signed request for the key, or
+// for the bucket itself when key is empty.
+func (s *s3) do(method, key string, query url.Values, body []byte) (response, error) {
+	u, err := url.Parse(s.url + "/" + s.bucket)
+	if err != nil {
+		return response{}, err
+	}
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return response{}, err
+	}
+
+	if method == "PUT" && query == nil {
+		req.Header.Set("Content-Type", "application/gzip")
+	}
+	s.credentials.sign(req, body, time.Now())
+
+	client := s.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return response{}, err
+	}
+	defer res.Body.Close()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(res.Body); err != nil {
+		return response{}, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return response{}, &utils.HTTPError{StatusCode: res.StatusCode, Status: res.Status, Header: res.Header, Body: buf.String()}
+	}
+
+	return response{header: res.Header, body: buf.Bytes()}, nil
+}
+
+// Close closes the logChannel. Anything already
+// on the stack will get uploaded.
+func (s *s3) Close() {
+	close(s.logChannel)
+}
@@ -0,0 +1,297 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+// minio imitates the few S3 APIs used, for a single bucket
+// with write-only credentials, failing the first failures
+// object or part uploads, and the first incomplete multipart
+// uploads with an error after a 200 status.
+type minio struct {
+	mutex      sync.Mutex
+	objects    map[string][]byte
+	uploads    map[string]map[int][]byte
+	parts      int
+	failures   int
+	incomplete int
+}
+
+func newMinio() *minio {
+	return &minio{objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+}
+
+func (m *minio) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") ||
+		r.Header.Get("X-Amz-Content-Sha256") != hashHex(body) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>")
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/logs/")
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == "GET":
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "<Error><Code>AccessDenied</Code></Error>")
+
+	case r.Method == "POST" && query.Has("uploads"):
+		id := strconv.Itoa(len(m.uploads) + 1)
+		m.uploads[id] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+
+	case r.Method == "PUT" && m.failures > 0:
+		m.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+	case r.Method == "PUT" && query.Has("uploadId"):
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		m.uploads[query.Get("uploadId")][n] = body
+		m.parts++
+		w.Header().Set("ETag", `"etag-`+strconv.Itoa(n)+`"`)
+
+	case r.Method == "POST" && query.Has("uploadId") && m.incomplete > 0:
+		m.incomplete--
+		fmt.Fprint(w, "<Error><Code>InternalError</Code><Message>Please try again.</Message></Error>")
+
+	case r.Method == "POST" && query.Has("uploadId"):
+		complete := completeMultipartUpload{}
+		xml.Unmarshal(body, &complete)
+
+		var object []byte
+		for _, p := range complete.Parts {
+			if p.ETag != `"etag-`+strconv.Itoa(p.PartNumber)+`"` {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			object = append(object, m.uploads[query.Get("uploadId")][p.PartNumber]...)
+		}
+		m.objects[key] = object
+
+	case r.Method == "DELETE" && query.Has("uploadId"):
+		delete(m.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == "PUT":
+		m.objects[key] = body
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// keys returns the keys of the objects of the prefix,
+// sorted by upload, checking their format.
+func (m *minio) keys(t *testing.T, prefix string) []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	keys := []string{}
+	for k := range m.objects {
+		if strings.HasPrefix(k, prefix+"-") {
+			assert.Regexp(t, `^`+prefix+`-\d{8}T\d{6}\.\d{3}Z-[0-9a-f]{8}\.json\.gz$`, k)
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *minio) records(t *testing.T, key string) []record {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	object, ok := m.objects[key]
+	if !ok {
+		t.Fatalf("missing object %s", key)
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(object))
+	assert.Nil(t, err)
+
+	records := []record{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		rec := record{}
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &rec))
+		records = append(records, rec)
+	}
+	return records
+}
+
+func newS3(url string, ch chan backend.RawLog, errCh chan error) *s3 {
+	s := New().Url(url).Bucket("logs").Cluster("prod").Credentials("access", "secret", "").LogChannel(ch).ErrChannel(errCh).Build()
+	s.backoff = 0
+	return s
+}
+
+// timestamp is 2023-10-01T00:00:00Z
+const timestamp = "1696118400000000000"
+
+func Test_Build(t *testing.T) {
+	ch := make(chan backend.RawLog)
+	errCh := make(chan error)
+
+	s := New().Url("http://minio:9000/").Bucket("logs").Cluster("prod").Credentials("access", "secret", "token").LogChannel(ch).ErrChannel(errCh).Build()
+
+	assert.Equal(t, "http://minio:9000", s.url)
+	assert.Equal(t, "logs", s.bucket)
+	assert.Equal(t, "prod", s.cluster)
+	assert.Equal(t, credentials{accessKey: "access", secretKey: "secret", sessionToken: "token", region: DefaultRegion}, s.credentials)
+	assert.Equal(t, ch, s.logChannel)
+	assert.Equal(t, errCh, s.errChannel)
+	assert.Equal(t, DefaultMaxSize, s.maxSize)
+	assert.Equal(t, DefaultMaxAge, s.maxAge)
+	assert.Equal(t, DefaultPartSize, s.partSize)
+	assert.Equal(t, 30*time.Second, s.checkInterval)
+}
+
+func Test_keyPrefix(t *testing.T) {
+	labels := map[string]string{"namespace": "hello", "pod": "world"}
+	ts := time.Date(2023, 10, 1, 13, 45, 0, 0, time.UTC)
+
+	assert.Equal(t, "prod/hello/world/2023/10/01/13", New().Cluster("prod").Build().keyPrefix(labels, ts))
+	assert.Equal(t, "hello/world/2023/10/01/13", New().Build().keyPrefix(labels, ts))
+}
+
+func Test_Stream(t *testing.T) {
+	m := newMinio()
+	ts := httptest.NewServer(m)
+	defer ts.Close()
+
+	ch := make(chan backend.RawLog, 4)
+	errCh := make(chan error, 1)
+
+	s := newS3(ts.URL, ch, errCh)
+
+	ch <- backend.RawLog{Log: "first", Timestamp: timestamp, Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	ch <- backend.RawLog{Log: "second", Timestamp: timestamp, Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	ch <- backend.RawLog{Log: "other", Timestamp: timestamp, Metadata: map[string]string{"namespace": "hello", "pod": "other"}}
+	// an hour later
+	ch <- backend.RawLog{Log: "later", Timestamp: "1696122000000000000", Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	s.Close()
+	s.Stream()
+
+	assert.Empty(t, errCh)
+	assert.Len(t, m.objects, 3)
+
+	keys := m.keys(t, "prod/hello/world/2023/10/01/00")
+	assert.Len(t, keys, 1)
+	records := m.records(t, keys[0])
+	assert.Len(t, records, 2)
+	assert.Equal(t, "first", records[0].Log)
+	assert.Equal(t, map[string]string{"namespace": "hello", "pod": "world"}, records[0].Labels)
+	assert.Equal(t, "second", records[1].Log)
+
+	assert.Equal(t, "other", m.records(t, m.keys(t, "prod/hello/other/2023/10/01/00")[0])[0].Log)
+	assert.Equal(t, "later", m.records(t, m.keys(t, "prod/hello/world/2023/10/01/01")[0])[0].Log)
+}
+
+func Test_StreamMaxSize(t *testing.T) {
+	m := newMinio()
+	ts := httptest.NewServer(m)
+	defer ts.Close()
+
+	ch := make(chan backend.RawLog, 3)
+	errCh := make(chan error, 1)
+
+	s := newS3(ts.URL, ch, errCh)
+	s.maxSize = 1
+
+	for _, log := range []string{"1", "2", "3"} {
+		ch <- backend.RawLog{Log: log, Timestamp: timestamp, Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	}
+	s.Close()
+	s.Stream()
+
+	assert.Empty(t, errCh)
+
+	// uploads within the same millisecond are in any order
+	logs := []string{}
+	keys := m.keys(t, "prod/hello/world/2023/10/01/00")
+	assert.Len(t, keys, 3)
+	for _, key := range keys {
+		logs = append(logs, m.records(t, key)[0].Log)
+	}
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, logs)
+}
+
+func Test_StreamMultipart(t *testing.T) {
+	m := newMinio()
+	// fail a part, then the completion, which
+	// each get the whole object retried
+	m.failures = 1
+	m.incomplete = 1
+	ts := httptest.NewServer(m)
+	defer ts.Close()
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	s := newS3(ts.URL, ch, errCh)
+	s.partSize = 1024
+
+	// random bytes don't compress
+	random := make([]byte, 2048)
+	rand.Read(random)
+	log := hex.EncodeToString(random)
+
+	ch <- backend.RawLog{Log: log, Timestamp: timestamp, Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	s.Close()
+	s.Stream()
+
+	assert.Empty(t, errCh)
+	keys := m.keys(t, "prod/hello/world/2023/10/01/00")
+	assert.Len(t, keys, 1)
+	assert.Equal(t, log, m.records(t, keys[0])[0].Log)
+	// the failed uploads were aborted
+	assert.Len(t, m.uploads, 1)
+	assert.GreaterOrEqual(t, m.parts, 5)
+}
+
+func Test_StreamErr(t *testing.T) {
+	m := newMinio()
+	ts := httptest.NewServer(m)
+	defer ts.Close()
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	s := New().Url(ts.URL).Bucket("logs").Credentials("invalid", "secret", "").LogChannel(ch).ErrChannel(errCh).Build()
+	s.backoff = 0
+
+	ch <- backend.RawLog{Log: "some log", Timestamp: timestamp, Metadata: map[string]string{"namespace": "hello", "pod": "world"}}
+	s.Close()
+	s.Stream()
+
+	err := <-errCh
+	assert.Contains(t, err.Error(), "dropped the logs of hello/world/2023/10/01/00 after 3 retries")
+	assert.Contains(t, err.Error(), "SignatureDoesNotMatch")
+	assert.Empty(t, m.objects)
+}
@@ -0,0 +1,227 @@
+package slack
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/phil-inc/admiral/pkg/utils"
+)
+
+const (
+	// maxRetries is how many times a rate-limited
+	// message is retried before it is dropped.
+	maxRetries = 3
+
+	// maxFieldLength is the most characters
+	// Slack renders in a section field.
+	maxFieldLength = 2000
+)
+
+// escaper escapes the characters Slack
+// reads as control ones in mrkdwn text.
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+type Builder struct {
+	url          string
+	client       *http.Client
+	eventChannel chan backend.Event
+	errChannel   chan error
+	fields       []string
+	channel      string
+	username     string
+	iconEmoji    string
+	iconURL      string
+}
+
+// New returns a builder for the slack struct.
+func New() *Builder {
+	return &Builder{}
+}
+
+// Url sets the incoming webhook url.
+func (b *Builder) Url(url string) *Builder {
+	b.url = url
+	return b
+}
+
+// EventChannel sets the channel from where
+// slack will take events.
+func (b *Builder) EventChannel(eventChannel chan backend.Event) *Builder {
+	b.eventChannel = eventChannel
+	return b
+}
+
+// ErrChannel sets the channel where slack
+// will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// Client sets the HTTP client.
+func (b *Builder) Client(client *http.Client) *Builder {
+	b.client = client
+	return b
+}
+
+// Fields sets which event fields are shown,
+// in order, in the message section.
+func (b *Builder) Fields(fields []string) *Builder {
+	b.fields = fields
+	return b
+}
+
+// Channel overrides the webhook's default channel.
+func (b *Builder) Channel(channel string) *Builder {
+	b.channel = channel
+	return b
+}
+
+// Username overrides the webhook's default username.
+func (b *Builder) Username(username string) *Builder {
+	b.username = username
+	return b
+}
+
+// Icon overrides the webhook's default icon with
+// either an emoji, such as ":ship:", or an image URL.
+func (b *Builder) Icon(emoji string, url string) *Builder {
+	b.iconEmoji = emoji
+	b.iconURL = url
+	return b
+}
+
+// Build returns a configured slack struct.
+func (b *Builder) Build() *slack {
+	fields := b.fields
+	if len(fields) == 0 {
+		fields = backend.DefaultFields
+	}
+
+	return &slack{
+		url:          b.url,
+		client:       b.client,
+		eventChannel: b.eventChannel,
+		errChannel:   b.errChannel,
+		fields:       fields,
+		channel:      b.channel,
+		username:     b.username,
+		iconEmoji:    b.iconEmoji,
+		iconURL:      b.iconURL,
+	}
+}
+
+type slack struct {
+	url          string
+	client       *http.Client
+	eventChannel chan backend.Event
+	errChannel   chan error
+	fields       []string
+	channel      string
+	username     string
+	iconEmoji    string
+	iconURL      string
+}
+
+type slackDTO struct {
+	Channel     string       `json:"channel,omitempty"`
+	Username    string       `json:"username,omitempty"`
+	IconEmoji   string       `json:"icon_emoji,omitempty"`
+	IconURL     string       `json:"icon_url,omitempty"`
+	Text        string       `json:"text"`
+	Attachments []attachment `json:"attachments"`
+}
+
+type attachment struct {
+	Color  string  `json:"color"`
+	Blocks []block `json:"blocks"`
+}
+
+type block struct {
+	Type   string `json:"type"`
+	Text   *text  `json:"text,omitempty"`
+	Fields []text `json:"fields,omitempty"`
+}
+
+type text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Stream waits to receive something
+// on eventChannel, then POSTs it to slack.
+func (s *slack) Stream() {
+	for event := range s.eventChannel {
+		err := utils.SendWithRetry(s.eventToDTO(event), "POST", s.url, nil, s.client, maxRetries)
+		if err != nil {
+			s.errChannel <- err
+		}
+	}
+}
+
+func (s *slack) eventToDTO(event backend.Event) *slackDTO {
+	fields := []text{}
+	for _, name := range s.fields {
+		value, ok := event.Field(name)
+		if !ok {
+			continue
+		}
+
+		fields = append(fields, text{
+			Type: "mrkdwn",
+			Text: truncate(fmt.Sprintf("*%s*\n%s", name, escaper.Replace(value))),
+		})
+	}
+
+	blocks := []block{
+		{
+			Type: "section",
+			Text: &text{
+				Type: "mrkdwn",
+				Text: fmt.Sprintf("*%s* in `%s`", escaper.Replace(event.Reason), escaper.Replace(event.Cluster)),
+			},
+		},
+	}
+
+	// Slack rejects sections without text or fields
+	if len(fields) > 0 {
+		blocks = append(blocks, block{Type: "section", Fields: fields})
+	}
+
+	color := "good"
+	if event.IsWarning() {
+		color = "danger"
+	}
+
+	return &slackDTO{
+		Channel:     s.channel,
+		Username:    s.username,
+		IconEmoji:   s.iconEmoji,
+		IconURL:     s.iconURL,
+		Text:        escaper.Replace(fmt.Sprintf("%s %s in %s", event.Type, event.Reason, event.Cluster)),
+		Attachments: []attachment{{Color: color, Blocks: blocks}},
+	}
+}
+
+// truncate cuts s to maxFieldLength characters,
+// before any escaped character it would split.
+func truncate(s string) string {
+	r := []rune(s)
+	if len(r) <= maxFieldLength {
+		return s
+	}
+
+	cut := string(r[:maxFieldLength-1])
+	if i := strings.LastIndex(cut, "&"); i >= 0 && !strings.Contains(cut[i:], ";") {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+// Close closes the eventChannel. Anything
+// already on the stack will get processed.
+func (s *slack) Close() {
+	close(s.eventChannel)
+}
@@ -0,0 +1,139 @@
+package slack
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/phil-inc/admiral/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Build(t *testing.T) {
+	cli := &http.Client{}
+	ch := make(chan backend.Event)
+
+	s := New().Client(cli).EventChannel(ch).Url("slack.com").Channel("#alerts").Username("admiral").Icon(":ship:", "").Build()
+
+	assert.NotNil(t, s)
+	assert.Equal(t, "slack.com", s.url)
+	assert.NotNil(t, s.client)
+	assert.Equal(t, ch, s.eventChannel)
+	assert.Equal(t, "#alerts", s.channel)
+	assert.Equal(t, "admiral", s.username)
+	assert.Equal(t, ":ship:", s.iconEmoji)
+	assert.Equal(t, backend.DefaultFields, s.fields)
+}
+
+func Test_eventToDTO(t *testing.T) {
+	s := New().Fields([]string{"namespace", "message"}).Build()
+
+	event := backend.Event{
+		Cluster:   "hello-cluster",
+		Namespace: "hello-namespace",
+		Reason:    "BackOff",
+		Type:      "Warning",
+		Message:   strings.Repeat("a", 3000),
+	}
+
+	dto := s.eventToDTO(event)
+
+	assert.Len(t, dto.Attachments, 1)
+	assert.Equal(t, "danger", dto.Attachments[0].Color)
+
+	blocks := dto.Attachments[0].Blocks
+	assert.Len(t, blocks, 2)
+	assert.Contains(t, blocks[0].Text.Text, "BackOff")
+	assert.Contains(t, blocks[0].Text.Text, "hello-cluster")
+	assert.Equal(t, "*namespace*\nhello-namespace", blocks[1].Fields[0].Text)
+	assert.Len(t, []rune(blocks[1].Fields[1].Text), maxFieldLength)
+
+	event.Type = "Normal"
+	dto = s.eventToDTO(event)
+	assert.Equal(t, "good", dto.Attachments[0].Color)
+
+	// control characters of mrkdwn are escaped
+	event.Message = "<!channel> Back-off & retry > 5m"
+	dto = s.eventToDTO(event)
+	assert.Equal(t, "*message*\n&lt;!channel&gt; Back-off &amp; retry &gt; 5m", dto.Attachments[0].Blocks[1].Fields[1].Text)
+
+	// without cutting through an escaped one
+	event.Message = strings.Repeat("a", maxFieldLength-len("*message*\n")-5) + "<<"
+	dto = s.eventToDTO(event)
+	assert.True(t, strings.HasSuffix(dto.Attachments[0].Blocks[1].Fields[1].Text, "a&lt;…"))
+}
+
+func Test_Stream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		b, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.Contains(t, string(b), "some event")
+		assert.Contains(t, string(b), `"channel":"#alerts"`)
+	}))
+
+	cli := &http.Client{}
+	ch := make(chan backend.Event)
+	errCh := make(chan error)
+
+	s := New().Client(cli).Url(server.URL).Channel("#alerts").EventChannel(ch).ErrChannel(errCh).Build()
+
+	go s.Stream()
+
+	s.eventChannel <- backend.Event{Message: "some event"}
+
+	s.Close()
+}
+
+func Test_RateLimit(t *testing.T) {
+	var received int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&received, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	ch := make(chan backend.Event, 1)
+	errCh := make(chan error, 1)
+
+	s := New().Client(&http.Client{}).Url(server.URL).EventChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- backend.Event{Message: "some event"}
+	s.Close()
+	s.Stream()
+
+	assert.Empty(t, errCh)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&received))
+}
+
+func Test_StreamErr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid_payload"))
+	}))
+
+	ch := make(chan backend.Event, 1)
+	errCh := make(chan error, 1)
+
+	s := New().Client(&http.Client{}).Url(server.URL).EventChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- backend.Event{Message: "some event"}
+	s.Close()
+	s.Stream()
+
+	err := <-errCh
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid_payload")
+
+	_, limited := utils.RetryAfter(err)
+	assert.False(t, limited)
+}
@@ -0,0 +1,398 @@
+package splunk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/phil-inc/admiral/pkg/utils"
+)
+
+const (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = 5 * time.Second
+	DefaultAckTimeout    = 30 * time.Second
+
+	eventPath = "/services/collector/event"
+	ackPath   = "/services/collector/ack"
+
+	// maxRetries is how many times a batch the indexers
+	// didn't acknowledge, or a request the HEC is too
+	// busy or rate limited for, is resent.
+	maxRetries = 3
+)
+
+type Builder struct {
+	url           string
+	client        *http.Client
+	logChannel    chan backend.RawLog
+	errChannel    chan error
+	token         string
+	index         *template.Template
+	source        *template.Template
+	sourcetype    *template.Template
+	batchSize     int
+	flushInterval time.Duration
+	ack           bool
+	ackTimeout    time.Duration
+}
+
+// New returns a builder for the splunk struct.
+func New() *Builder {
+	return &Builder{}
+}
+
+// Url sets the url of the HTTP Event Collector.
+func (b *Builder) Url(url string) *Builder {
+	b.url = url
+	return b
+}
+
+// LogChannel sets the channel from where
+// splunk will take logs.
+func (b *Builder) LogChannel(logChannel chan backend.RawLog) *Builder {
+	b.logChannel = logChannel
+	return b
+}
+
+// ErrChannel sets the channel where splunk
+// will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// Client sets the HTTP client.
+func (b *Builder) Client(client *http.Client) *Builder {
+	b.client = client
+	return b
+}
+
+// Token sets the HEC token.
+func (b *Builder) Token(token string) *Builder {
+	b.token = token
+	return b
+}
+
+// Index sets the template rendering the
+// index of a log from its labels.
+func (b *Builder) Index(index *template.Template) *Builder {
+	b.index = index
+	return b
+}
+
+// Source sets the template rendering the
+// source of a log from its labels.
+func (b *Builder) Source(source *template.Template) *Builder {
+	b.source = source
+	return b
+}
+
+// Sourcetype sets the template rendering
+// the sourcetype of a log from its labels.
+func (b *Builder) Sourcetype(sourcetype *template.Template) *Builder {
+	b.sourcetype = sourcetype
+	return b
+}
+
+// Batch sets how many logs are buffered
+// at most, and how long, before a flush.
+func (b *Builder) Batch(size int, interval time.Duration) *Builder {
+	b.batchSize = size
+	b.flushInterval = interval
+	return b
+}
+
+// Ack waits for the indexers to acknowledge each
+// batch, resending it if they don't within timeout.
+func (b *Builder) Ack(ack bool, timeout time.Duration) *Builder {
+	b.ack = ack
+	b.ackTimeout = timeout
+	return b
+}
+
+// Build returns a configured splunk struct.
+func (b *Builder) Build() *splunk {
+	s := &splunk{
+		url:           strings.TrimSuffix(b.url, "/"),
+		client:        b.client,
+		logChannel:    b.logChannel,
+		errChannel:    b.errChannel,
+		headers:       map[string]string{"Authorization": "Splunk " + b.token},
+		index:         b.index,
+		source:        b.source,
+		sourcetype:    b.sourcetype,
+		batchSize:     b.batchSize,
+		flushInterval: b.flushInterval,
+		ack:           b.ack,
+		ackTimeout:    b.ackTimeout,
+		ackInterval:   time.Second,
+		backoff:       time.Second,
+	}
+
+	if s.batchSize <= 0 {
+		s.batchSize = DefaultBatchSize
+	}
+	if s.flushInterval <= 0 {
+		s.flushInterval = DefaultFlushInterval
+	}
+	if s.ackTimeout <= 0 {
+		s.ackTimeout = DefaultAckTimeout
+	}
+
+	// acknowledgement is tracked per channel, which
+	// every request must then identify itself with
+	if s.ack {
+		s.headers["X-Splunk-Request-Channel"] = uuid.NewString()
+	}
+
+	return s
+}
+
+type splunk struct {
+	url           string
+	client        *http.Client
+	logChannel    chan backend.RawLog
+	errChannel    chan error
+	headers       map[string]string
+	index         *template.Template
+	source        *template.Template
+	sourcetype    *template.Template
+	batchSize     int
+	flushInterval time.Duration
+	ack           bool
+	ackTimeout    time.Duration
+	ackInterval   time.Duration
+	backoff       time.Duration
+}
+
+type hecEvent struct {
+	Time       float64           `json:"time"`
+	Index      string            `json:"index,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	Sourcetype string            `json:"sourcetype,omitempty"`
+	Event      string            `json:"event"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+type hecResponse struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID *int   `json:"ackId"`
+}
+
+type ackRequest struct {
+	Acks []int `json:"acks"`
+}
+
+type ackResponse struct {
+	Acks map[string]bool `json:"acks"`
+}
+
+// Stream buffers logs into batches of HEC events, flushing
+// them once the batch is full, at every flush interval,
+// and when logChannel is closed.
+func (s *splunk) Stream() {
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	batch := []hecEvent{}
+
+	for {
+		select {
+		case raw, ok := <-s.logChannel:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+
+			event, err := s.rawLogToEvent(raw)
+			if err != nil {
+				s.errChannel <- err
+				continue
+			}
+
+			batch = append(batch, event)
+			if len(batch) >= s.batchSize {
+				s.flush(batch)
+				batch = []hecEvent{}
+			}
+
+		case <-ticker.C:
+			s.flush(batch)
+			batch = []hecEvent{}
+		}
+	}
+}
+
+func (s *splunk) rawLogToEvent(r backend.RawLog) (hecEvent, error) {
+	t := time.Now()
+	if ns, err := strconv.ParseInt(r.Timestamp, 10, 64); err == nil {
+		t = time.Unix(0, ns)
+	}
+
+	index, err := render(s.index, r.Metadata)
+	if err != nil {
+		return hecEvent{}, err
+	}
+
+	source, err := render(s.source, r.Metadata)
+	if err != nil {
+		return hecEvent{}, err
+	}
+
+	sourcetype, err := render(s.sourcetype, r.Metadata)
+	if err != nil {
+		return hecEvent{}, err
+	}
+
+	return hecEvent{
+		Time:       float64(t.UnixMicro()) / 1e6,
+		Index:      index,
+		Source:     source,
+		Sourcetype: sourcetype,
+		Event:      r.Log,
+		Fields:     r.Metadata,
+	}, nil
+}
+
+func render(t *template.Template, labels map[string]string) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+
+	var buf strings.Builder
+	if err := t.Execute(&buf, labels); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// flush sends the batch, and with acknowledgement
+// enabled, resends it until the indexers ack it.
+func (s *splunk) flush(batch []hecEvent) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, event := range batch {
+		if err := encoder.Encode(event); err != nil {
+			s.errChannel <- err
+			return
+		}
+	}
+
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		res, err := s.post(s.url+eventPath, body.Bytes())
+		if err != nil {
+			s.errChannel <- err
+			return
+		}
+
+		if !s.ack {
+			return
+		}
+
+		hec := hecResponse{}
+		if err := json.Unmarshal(res, &hec); err != nil {
+			s.errChannel <- err
+			return
+		}
+
+		if hec.AckID == nil {
+			s.errChannel <- fmt.Errorf("splunk: indexer acknowledgement is not enabled on the token")
+			return
+		}
+
+		acked, err := s.waitForAck(*hec.AckID)
+		if err != nil {
+			s.errChannel <- err
+			return
+		}
+
+		if acked {
+			return
+		}
+	}
+
+	s.errChannel <- fmt.Errorf("splunk: dropped %d events the indexers didn't acknowledge", len(batch))
+}
+
+// waitForAck polls the ack endpoint until the
+// indexers acknowledge the id or ackTimeout passes.
+func (s *splunk) waitForAck(id int) (bool, error) {
+	body, err := json.Marshal(ackRequest{Acks: []int{id}})
+	if err != nil {
+		return false, err
+	}
+
+	deadline := time.Now().Add(s.ackTimeout)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(s.ackInterval)
+
+		res, err := s.post(s.url+ackPath, body)
+		if err != nil {
+			return false, err
+		}
+
+		acks := ackResponse{}
+		if err := json.Unmarshal(res, &acks); err != nil {
+			return false, err
+		}
+
+		if acks.Acks[strconv.Itoa(id)] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// post sends the body, resending it while the HEC
+// rate limits, waiting as long as it asks to, or is
+// busy with full queues, backing off in between.
+func (s *splunk) post(url string, body []byte) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		res, err := s.do(url, body)
+
+		wait, limited := utils.RetryAfter(err)
+		if httpErr, ok := err.(*utils.HTTPError); ok && httpErr.StatusCode == http.StatusServiceUnavailable {
+			wait, limited = s.backoff*time.Duration(attempt+1), true
+		}
+		if !limited || attempt == maxRetries {
+			return res, err
+		}
+
+		time.Sleep(wait)
+	}
+}
+
+func (s *splunk) do(url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	return utils.Do(req, s.client)
+}
+
+// Close closes the logChannel. Anything
+// already on the stack will get flushed.
+func (s *splunk) Close() {
+	close(s.logChannel)
+}
@@ -0,0 +1,218 @@
+package splunk
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+// hecServer imitates the HTTP Event Collector, only
+// acknowledging a batch on the acks-th poll for it, and
+// rejecting the first busy batches alternately with a
+// 503 and a 429.
+type hecServer struct {
+	mutex   sync.Mutex
+	acks    int
+	polls   int
+	busy    int
+	events  []hecEvent
+	batches int
+}
+
+func (s *hecServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if r.Header.Get("Authorization") != "Splunk token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"text":"Invalid token","code":4}`)
+		return
+	}
+
+	switch r.URL.Path {
+	case eventPath:
+		if s.busy > 0 {
+			s.busy--
+			if s.busy%2 == 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprint(w, `{"text":"Server is busy","code":9}`)
+				return
+			}
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		s.batches++
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			event := hecEvent{}
+			json.Unmarshal(scanner.Bytes(), &event)
+			s.events = append(s.events, event)
+		}
+
+		if r.Header.Get("X-Splunk-Request-Channel") == "" {
+			fmt.Fprint(w, `{"text":"Success","code":0}`)
+			return
+		}
+		fmt.Fprintf(w, `{"text":"Success","code":0,"ackId":%d}`, s.batches)
+
+	case ackPath:
+		s.polls++
+		fmt.Fprintf(w, `{"acks":{"%d":%t}}`, s.batches, s.polls%s.acks == 0)
+	}
+}
+
+func Test_Build(t *testing.T) {
+	cli := &http.Client{}
+	ch := make(chan backend.RawLog)
+
+	s := New().Client(cli).LogChannel(ch).Url("https://splunk:8088/").Token("token").Build()
+
+	assert.NotNil(t, s)
+	assert.Equal(t, "https://splunk:8088", s.url)
+	assert.Equal(t, ch, s.logChannel)
+	assert.Equal(t, "Splunk token", s.headers["Authorization"])
+	assert.NotContains(t, s.headers, "X-Splunk-Request-Channel")
+	assert.Equal(t, DefaultBatchSize, s.batchSize)
+
+	s = New().Ack(true, 0).Build()
+	assert.NotEmpty(t, s.headers["X-Splunk-Request-Channel"])
+	assert.Equal(t, DefaultAckTimeout, s.ackTimeout)
+}
+
+func Test_rawLogToEvent(t *testing.T) {
+	index := template.Must(template.New("index").Parse("k8s_{{.namespace}}"))
+	sourcetype := template.Must(template.New("sourcetype").Parse("kube:{{.container}}"))
+
+	s := New().Index(index).Sourcetype(sourcetype).Build()
+
+	event, err := s.rawLogToEvent(backend.RawLog{
+		Log:       "some log",
+		Metadata:  map[string]string{"namespace": "hello", "container": "world"},
+		Timestamp: "1696118400500000000",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1696118400.5, event.Time)
+	assert.Equal(t, "k8s_hello", event.Index)
+	assert.Empty(t, event.Source)
+	assert.Equal(t, "kube:world", event.Sourcetype)
+	assert.Equal(t, "some log", event.Event)
+	assert.Equal(t, "hello", event.Fields["namespace"])
+}
+
+func Test_Stream(t *testing.T) {
+	server := &hecServer{}
+	ts := httptest.NewServer(server)
+
+	ch := make(chan backend.RawLog, 3)
+	errCh := make(chan error, 1)
+
+	s := New().Client(&http.Client{}).Url(ts.URL).Token("token").Batch(2, time.Hour).LogChannel(ch).ErrChannel(errCh).Build()
+
+	for i := 0; i < 3; i++ {
+		ch <- backend.RawLog{Log: fmt.Sprintf("log %d", i)}
+	}
+	s.Close()
+	s.Stream()
+
+	assert.Empty(t, errCh)
+	assert.Equal(t, 2, server.batches)
+	assert.Len(t, server.events, 3)
+	assert.Zero(t, server.polls)
+}
+
+func Test_StreamAck(t *testing.T) {
+	server := &hecServer{acks: 2}
+	ts := httptest.NewServer(server)
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	s := New().Client(&http.Client{}).Url(ts.URL).Token("token").Ack(true, time.Second).LogChannel(ch).ErrChannel(errCh).Build()
+	s.ackInterval = time.Millisecond
+
+	ch <- backend.RawLog{Log: "some log"}
+	s.Close()
+	s.Stream()
+
+	assert.Empty(t, errCh)
+	assert.Equal(t, 1, server.batches)
+	assert.Equal(t, 2, server.polls)
+}
+
+func Test_StreamAckTimeout(t *testing.T) {
+	server := &hecServer{acks: 1000}
+	ts := httptest.NewServer(server)
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	s := New().Client(&http.Client{}).Url(ts.URL).Token("token").Ack(true, 5*time.Millisecond).LogChannel(ch).ErrChannel(errCh).Build()
+	s.ackInterval = time.Millisecond
+
+	ch <- backend.RawLog{Log: "some log"}
+	s.Close()
+	s.Stream()
+
+	assert.Equal(t, maxRetries+1, server.batches)
+	assert.Contains(t, (<-errCh).Error(), "didn't acknowledge")
+}
+
+func Test_StreamErr(t *testing.T) {
+	ts := httptest.NewServer(&hecServer{})
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	s := New().Client(&http.Client{}).Url(ts.URL).Token("wrong").LogChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- backend.RawLog{Log: "some log"}
+	s.Close()
+	s.Stream()
+
+	assert.Contains(t, (<-errCh).Error(), "Invalid token")
+}
+
+func Test_StreamBusy(t *testing.T) {
+	server := &hecServer{busy: 2}
+	ts := httptest.NewServer(server)
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	s := New().Client(&http.Client{}).Url(ts.URL).Token("token").LogChannel(ch).ErrChannel(errCh).Build()
+	s.backoff = time.Millisecond
+
+	ch <- backend.RawLog{Log: "some log"}
+	s.Close()
+	s.Stream()
+
+	assert.Empty(t, errCh)
+	assert.Equal(t, 1, server.batches)
+	assert.Len(t, server.events, 1)
+
+	// still busy after every retry
+	server = &hecServer{busy: maxRetries + 1}
+	ts = httptest.NewServer(server)
+
+	ch = make(chan backend.RawLog, 1)
+	s = New().Client(&http.Client{}).Url(ts.URL).Token("token").LogChannel(ch).ErrChannel(errCh).Build()
+	s.backoff = time.Millisecond
+
+	ch <- backend.RawLog{Log: "some log"}
+	s.Close()
+	s.Stream()
+
+	assert.Contains(t, (<-errCh).Error(), "Server is busy")
+	assert.Empty(t, server.events)
+}
@@ -0,0 +1,394 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+)
+
+const (
+	TransportUDP = "udp"
+	TransportTCP = "tcp"
+	TransportTLS = "tls"
+
+	// DefaultSDID is the structured data element labels are
+	// sent in, under the enterprise number for documentation.
+	DefaultSDID = "labels@32473"
+
+	dialTimeout = 10 * time.Second
+
+	// maximum lengths of the header fields in RFC5424
+	maxHostnameLength = 255
+	maxAppNameLength  = 48
+	maxMsgIDLength    = 32
+	maxParamLength    = 32
+)
+
+// Facilities are the syslog facility codes by name.
+var Facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3,
+	"auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Severities are the syslog severity codes by name.
+var Severities = map[string]int{
+	"emerg": 0, "alert": 1, "crit": 2, "err": 3,
+	"warning": 4, "notice": 5, "info": 6, "debug": 7,
+}
+
+type Builder struct {
+	transport    string
+	address      string
+	tlsConfig    *tls.Config
+	logChannel   chan backend.RawLog
+	eventChannel chan backend.Event
+	errChannel   chan error
+	facility     int
+	severity     int
+	sdID         string
+}
+
+// New returns a builder for the syslog struct.
+func New() *Builder {
+	return &Builder{
+		facility: Facilities["local0"],
+		severity: -1,
+	}
+}
+
+// Transport sets how messages are sent: TransportUDP,
+// TransportTCP (default) or TransportTLS.
+func (b *Builder) Transport(transport string) *Builder {
+	b.transport = transport
+	return b
+}
+
+// Address sets the host:port of the syslog server.
+func (b *Builder) Address(address string) *Builder {
+	b.address = address
+	return b
+}
+
+// TLSConfig sets the configuration of TransportTLS.
+func (b *Builder) TLSConfig(tlsConfig *tls.Config) *Builder {
+	b.tlsConfig = tlsConfig
+	return b
+}
+
+// LogChannel sets the channel from where
+// syslog will take logs.
+func (b *Builder) LogChannel(logChannel chan backend.RawLog) *Builder {
+	b.logChannel = logChannel
+	return b
+}
+
+// EventChannel sets the channel from where
+// syslog will take events.
+func (b *Builder) EventChannel(eventChannel chan backend.Event) *Builder {
+	b.eventChannel = eventChannel
+	return b
+}
+
+// ErrChannel sets the channel where syslog
+// will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// Facility sets the facility code of
+// messages, defaulting to local0.
+func (b *Builder) Facility(facility int) *Builder {
+	b.facility = facility
+	return b
+}
+
+// Severity sets the severity code of every message.
+// Without it, logs are info, and events are warning
+// or notice depending on their type.
+func (b *Builder) Severity(severity int) *Builder {
+	b.severity = severity
+	return b
+}
+
+// SDID sets the ID of the structured data
+// element labels are sent in.
+func (b *Builder) SDID(sdID string) *Builder {
+	b.sdID = sdID
+	return b
+}
+
+// Build returns a configured syslog struct.
+func (b *Builder) Build() *syslog {
+	transport := b.transport
+	if transport == "" {
+		transport = TransportTCP
+	}
+
+	sdID := b.sdID
+	if sdID == "" {
+		sdID = DefaultSDID
+	}
+
+	return &syslog{
+		transport:    transport,
+		address:      b.address,
+		tlsConfig:    b.tlsConfig,
+		logChannel:   b.logChannel,
+		eventChannel: b.eventChannel,
+		errChannel:   b.errChannel,
+		facility:     b.facility,
+		severity:     b.severity,
+		sdID:         sdID,
+	}
+}
+
+type syslog struct {
+	transport    string
+	address      string
+	tlsConfig    *tls.Config
+	logChannel   chan backend.RawLog
+	eventChannel chan backend.Event
+	errChannel   chan error
+	facility     int
+	severity     int
+	sdID         string
+	conn         net.Conn
+	mutex        sync.Mutex
+}
+
+// message holds the fields of an RFC5424 message.
+type message struct {
+	severity  int
+	timestamp time.Time
+	hostname  string
+	appName   string
+	msgID     string
+	params    map[string]string
+	msg       string
+}
+
+// Stream writes whatever is received on logChannel
+// and eventChannel to the syslog server.
+func (s *syslog) Stream() {
+	if s.eventChannel != nil {
+		go s.streamEvents()
+	}
+
+	for raw := range s.logChannel {
+		s.send(s.rawLogToMessage(raw))
+	}
+}
+
+func (s *syslog) streamEvents() {
+	for event := range s.eventChannel {
+		s.send(s.eventToMessage(event))
+	}
+}
+
+func (s *syslog) rawLogToMessage(r backend.RawLog) message {
+	t := time.Now()
+	if ns, err := strconv.ParseInt(r.Timestamp, 10, 64); err == nil {
+		t = time.Unix(0, ns)
+	}
+
+	params := make(map[string]string)
+	for k, v := range r.Metadata {
+		if k != "pod" && k != "container" {
+			params[k] = v
+		}
+	}
+
+	severity := s.severity
+	if severity < 0 {
+		severity = Severities["info"]
+	}
+
+	return message{
+		severity:  severity,
+		timestamp: t,
+		hostname:  r.Metadata["pod"],
+		appName:   r.Metadata["container"],
+		params:    params,
+		msg:       r.Log,
+	}
+}
+
+func (s *syslog) eventToMessage(event backend.Event) message {
+	severity := s.severity
+	if severity < 0 {
+		severity = Severities["notice"]
+		if event.IsWarning() {
+			severity = Severities["warning"]
+		}
+	}
+
+	return message{
+		severity:  severity,
+		timestamp: event.Timestamp,
+		hostname:  event.Name,
+		appName:   strings.ToLower(event.Kind),
+		msgID:     event.Reason,
+		params: map[string]string{
+			"cluster":   event.Cluster,
+			"namespace": event.Namespace,
+			"type":      event.Type,
+		},
+		msg: event.Message,
+	}
+}
+
+// format renders the message as RFC5424.
+func (s *syslog) format(m message) string {
+	timestamp := "-"
+	if !m.timestamp.IsZero() {
+		timestamp = m.timestamp.Format("2006-01-02T15:04:05.000000Z07:00")
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s - %s %s %s",
+		s.facility*8+m.severity,
+		timestamp,
+		headerField(m.hostname, maxHostnameLength),
+		headerField(m.appName, maxAppNameLength),
+		headerField(m.msgID, maxMsgIDLength),
+		s.structuredData(m.params),
+		m.msg,
+	)
+}
+
+func (s *syslog) structuredData(params map[string]string) string {
+	keys := []string{}
+	for k, v := range params {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+
+	if len(keys) == 0 {
+		return "-"
+	}
+	sort.Strings(keys)
+
+	var sd strings.Builder
+	sd.WriteString("[" + s.sdID)
+	for _, k := range keys {
+		fmt.Fprintf(&sd, ` %s="%s"`, paramName(k), paramValueEscaper.Replace(params[k]))
+	}
+	sd.WriteString("]")
+
+	return sd.String()
+}
+
+// headerField makes a header field printable and
+// short enough, or nil ("-") when it is empty.
+func headerField(s string, max int) string {
+	field := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, s)
+
+	if len(field) > max {
+		field = field[:max]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
+
+// paramName replaces the characters which
+// can't be part of a parameter name.
+func paramName(s string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, s)
+
+	if len(name) > maxParamLength {
+		name = name[:maxParamLength]
+	}
+	return name
+}
+
+var paramValueEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// send writes the message, reconnecting and
+// retrying once if the connection was dropped.
+func (s *syslog) send(m message) {
+	msg := s.format(m)
+	if s.transport != TransportUDP {
+		// octet-counting framing of RFC6587
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			s.conn, err = s.dial()
+			if err != nil {
+				continue
+			}
+		}
+
+		_, err = s.conn.Write([]byte(msg))
+		if err == nil {
+			return
+		}
+
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	s.errChannel <- err
+}
+
+func (s *syslog) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	switch s.transport {
+	case TransportTLS:
+		return tls.DialWithDialer(dialer, "tcp", s.address, s.tlsConfig)
+	case TransportUDP:
+		return dialer.Dial("udp", s.address)
+	default:
+		return dialer.Dial("tcp", s.address)
+	}
+}
+
+// Close closes the injected channels and the
+// connection. Anything already on the stack
+// will get processed.
+func (s *syslog) Close() {
+	if s.logChannel != nil {
+		close(s.logChannel)
+	}
+
+	if s.eventChannel != nil {
+		close(s.eventChannel)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
@@ -0,0 +1,175 @@
+package syslog
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+// readFrame reads an octet-counted message.
+func readFrame(t *testing.T, r *bufio.Reader) string {
+	length, err := r.ReadString(' ')
+	assert.Nil(t, err)
+
+	n, err := strconv.Atoi(strings.TrimSpace(length))
+	assert.Nil(t, err)
+
+	msg := make([]byte, n)
+	_, err = r.Read(msg)
+	assert.Nil(t, err)
+
+	return string(msg)
+}
+
+func Test_Build(t *testing.T) {
+	ch := make(chan backend.RawLog)
+
+	s := New().Address("localhost:514").LogChannel(ch).Build()
+
+	assert.NotNil(t, s)
+	assert.Equal(t, TransportTCP, s.transport)
+	assert.Equal(t, "localhost:514", s.address)
+	assert.Equal(t, ch, s.logChannel)
+	assert.Equal(t, Facilities["local0"], s.facility)
+	assert.Equal(t, DefaultSDID, s.sdID)
+}
+
+func Test_format(t *testing.T) {
+	s := New().Facility(Facilities["local3"]).Build()
+
+	m := s.rawLogToMessage(backend.RawLog{
+		Log:       "some log",
+		Timestamp: "1696118400123456000",
+		Metadata: map[string]string{
+			"pod":       "hello-pod",
+			"container": "world",
+			"namespace": "hello",
+			"app":       `a "quoted" ]value\`,
+		},
+	})
+	m.timestamp = m.timestamp.UTC()
+
+	assert.Equal(t, `<158>1 2023-10-01T00:00:00.123456Z hello-pod world - - [labels@32473 app="a \"quoted\" \]value\\" namespace="hello"] some log`, s.format(m))
+
+	m = s.eventToMessage(backend.Event{Name: "hello-node", Kind: "Node", Reason: "NodeNotReady", Type: "Warning", Message: "some event"})
+	assert.Equal(t, `<156>1 - hello-node node - NodeNotReady [labels@32473 type="Warning"] some event`, s.format(m))
+
+	m = New().Severity(Severities["crit"]).Build().eventToMessage(backend.Event{Message: "some event"})
+	assert.Equal(t, `<130>1 - - - - - - some event`, New().Severity(Severities["crit"]).Build().format(m))
+}
+
+func Test_StreamUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	s := New().Transport(TransportUDP).Address(conn.LocalAddr().String()).LogChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- backend.RawLog{Log: "some log"}
+	close(ch)
+	s.Stream()
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(buf[:n]), "<134>1 "))
+	assert.True(t, strings.HasSuffix(string(buf[:n]), " some log"))
+	assert.Empty(t, errCh)
+}
+
+func Test_StreamTLS(t *testing.T) {
+	// borrow the certificate of an httptest server
+	ts := httptest.NewTLSServer(nil)
+	defer ts.Close()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: ts.TLS.Certificates})
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		assert.Nil(t, err)
+		received <- readFrame(t, bufio.NewReader(conn))
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+
+	events := make(chan backend.Event, 1)
+	errCh := make(chan error, 1)
+
+	s := New().Transport(TransportTLS).Address(listener.Addr().String()).TLSConfig(&tls.Config{RootCAs: pool, ServerName: "example.com"}).EventChannel(events).ErrChannel(errCh).Build()
+
+	go s.Stream()
+	events <- backend.Event{Reason: "NodeNotReady", Message: "some event"}
+
+	select {
+	case msg := <-received:
+		assert.Contains(t, msg, " NodeNotReady ")
+		assert.True(t, strings.HasSuffix(msg, " some event"))
+	case err := <-errCh:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the message")
+	}
+}
+
+func Test_Reconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	received := make(chan string, 10)
+	go func() {
+		// drop the first connection after its first message
+		conn, err := listener.Accept()
+		assert.Nil(t, err)
+		received <- readFrame(t, bufio.NewReader(conn))
+		conn.Close()
+
+		conn, err = listener.Accept()
+		assert.Nil(t, err)
+		defer conn.Close()
+
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- "reconnected: " + line
+	}()
+
+	errCh := make(chan error, 10)
+	s := New().Address(listener.Addr().String()).ErrChannel(errCh).Build()
+
+	defer s.Close()
+
+	s.send(s.rawLogToMessage(backend.RawLog{Log: "first"}))
+	assert.Contains(t, <-received, "first")
+
+	// writes only fail once the peer's reset arrives
+	for i := 0; i < 10; i++ {
+		time.Sleep(10 * time.Millisecond)
+		s.send(s.rawLogToMessage(backend.RawLog{Log: "again\n"}))
+
+		select {
+		case msg := <-received:
+			assert.True(t, strings.HasPrefix(msg, "reconnected: "))
+			assert.Empty(t, errCh)
+			return
+		default:
+		}
+	}
+
+	t.Fatal("never reconnected")
+}
@@ -0,0 +1,198 @@
+package teams
+
+import (
+	"net/http"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/phil-inc/admiral/pkg/utils"
+)
+
+const (
+	// maxRetries is how many times a rate-limited
+	// message is retried before it is dropped.
+	maxRetries = 3
+
+	cardContentType = "application/vnd.microsoft.card.adaptive"
+	cardSchema      = "http://adaptivecards.io/schemas/adaptive-card.json"
+	cardVersion     = "1.4"
+)
+
+type Builder struct {
+	url          string
+	client       *http.Client
+	eventChannel chan backend.Event
+	errChannel   chan error
+	fields       []string
+}
+
+// New returns a builder for the teams struct.
+func New() *Builder {
+	return &Builder{}
+}
+
+// Url sets the workflow webhook url.
+func (b *Builder) Url(url string) *Builder {
+	b.url = url
+	return b
+}
+
+// EventChannel sets the channel from where
+// teams will take events.
+func (b *Builder) EventChannel(eventChannel chan backend.Event) *Builder {
+	b.eventChannel = eventChannel
+	return b
+}
+
+// ErrChannel sets the channel where teams
+// will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// Client sets the HTTP client.
+func (b *Builder) Client(client *http.Client) *Builder {
+	b.client = client
+	return b
+}
+
+// Fields sets which event fields are shown,
+// in order, in the card's fact set.
+func (b *Builder) Fields(fields []string) *Builder {
+	b.fields = fields
+	return b
+}
+
+// Build returns a configured teams struct.
+func (b *Builder) Build() *teams {
+	fields := b.fields
+	if len(fields) == 0 {
+		fields = backend.DefaultFields
+	}
+
+	return &teams{
+		url:          b.url,
+		client:       b.client,
+		eventChannel: b.eventChannel,
+		errChannel:   b.errChannel,
+		fields:       fields,
+	}
+}
+
+type teams struct {
+	url          string
+	client       *http.Client
+	eventChannel chan backend.Event
+	errChannel   chan error
+	fields       []string
+}
+
+type teamsDTO struct {
+	Type        string       `json:"type"`
+	Attachments []attachment `json:"attachments"`
+}
+
+type attachment struct {
+	ContentType string       `json:"contentType"`
+	Content     adaptiveCard `json:"content"`
+}
+
+type adaptiveCard struct {
+	Schema  string    `json:"$schema"`
+	Type    string    `json:"type"`
+	Version string    `json:"version"`
+	Body    []element `json:"body"`
+	MSTeams msTeams   `json:"msteams"`
+}
+
+type msTeams struct {
+	Width string `json:"width"`
+}
+
+// element is any Adaptive Card element
+// admiral uses: Container, TextBlock or FactSet.
+type element struct {
+	Type     string    `json:"type"`
+	Style    string    `json:"style,omitempty"`
+	Bleed    bool      `json:"bleed,omitempty"`
+	Items    []element `json:"items,omitempty"`
+	Text     string    `json:"text,omitempty"`
+	Weight   string    `json:"weight,omitempty"`
+	Size     string    `json:"size,omitempty"`
+	Color    string    `json:"color,omitempty"`
+	IsSubtle bool      `json:"isSubtle,omitempty"`
+	Spacing  string    `json:"spacing,omitempty"`
+	Wrap     bool      `json:"wrap,omitempty"`
+	Facts    []fact    `json:"facts,omitempty"`
+}
+
+type fact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// Stream waits to receive something
+// on eventChannel, then POSTs it to teams.
+func (t *teams) Stream() {
+	for event := range t.eventChannel {
+		err := utils.SendWithRetry(t.eventToDTO(event), "POST", t.url, nil, t.client, maxRetries)
+		if err != nil {
+			t.errChannel <- err
+		}
+	}
+}
+
+// eventToDTO lays the event out as an Adaptive Card: a
+// header colored by severity with the reason and cluster,
+// followed by a fact per configured field.
+func (t *teams) eventToDTO(event backend.Event) *teamsDTO {
+	style, color := "good", "Good"
+	if event.IsWarning() {
+		style, color = "attention", "Attention"
+	}
+
+	facts := []fact{}
+	for _, name := range t.fields {
+		value, ok := event.Field(name)
+		if !ok {
+			continue
+		}
+		facts = append(facts, fact{Title: name, Value: value})
+	}
+
+	return &teamsDTO{
+		Type: "message",
+		Attachments: []attachment{
+			{
+				ContentType: cardContentType,
+				Content: adaptiveCard{
+					Schema:  cardSchema,
+					Type:    "AdaptiveCard",
+					Version: cardVersion,
+					MSTeams: msTeams{Width: "Full"},
+					Body: []element{
+						{
+							Type:  "Container",
+							Style: style,
+							Bleed: true,
+							Items: []element{
+								{Type: "TextBlock", Text: event.Reason, Weight: "Bolder", Size: "Medium", Color: color, Wrap: true},
+								{Type: "TextBlock", Text: event.Cluster, IsSubtle: true, Spacing: "None"},
+							},
+						},
+						{
+							Type:  "FactSet",
+							Facts: facts,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Close closes the eventChannel. Anything
+// already on the stack will get processed.
+func (t *teams) Close() {
+	close(t.eventChannel)
+}
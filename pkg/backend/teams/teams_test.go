@@ -0,0 +1,98 @@
+package teams
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Build(t *testing.T) {
+	cli := &http.Client{}
+	ch := make(chan backend.Event)
+
+	tm := New().Client(cli).EventChannel(ch).Url("teams.com").Build()
+
+	assert.NotNil(t, tm)
+	assert.Equal(t, "teams.com", tm.url)
+	assert.NotNil(t, tm.client)
+	assert.Equal(t, ch, tm.eventChannel)
+	assert.Equal(t, backend.DefaultFields, tm.fields)
+}
+
+func Test_eventToDTO(t *testing.T) {
+	tm := New().Fields([]string{"namespace", "object"}).Build()
+
+	event := backend.Event{
+		Cluster:   "hello-cluster",
+		Namespace: "hello-namespace",
+		Name:      "hello-pod",
+		Reason:    "BackOff",
+		Type:      "Warning",
+	}
+
+	dto := tm.eventToDTO(event)
+
+	assert.Equal(t, "message", dto.Type)
+	assert.Equal(t, cardContentType, dto.Attachments[0].ContentType)
+
+	body := dto.Attachments[0].Content.Body
+	assert.Equal(t, "attention", body[0].Style)
+	assert.Equal(t, "BackOff", body[0].Items[0].Text)
+	assert.Equal(t, "hello-cluster", body[0].Items[1].Text)
+	assert.Equal(t, []fact{
+		{Title: "namespace", Value: "hello-namespace"},
+		{Title: "object", Value: "hello-pod"},
+	}, body[1].Facts)
+
+	event.Type = "Normal"
+	dto = tm.eventToDTO(event)
+	assert.Equal(t, "good", dto.Attachments[0].Content.Body[0].Style)
+}
+
+func Test_Stream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		b, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.Contains(t, string(b), "some event")
+		assert.Contains(t, string(b), "AdaptiveCard")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	cli := &http.Client{}
+	ch := make(chan backend.Event, 1)
+	errCh := make(chan error, 1)
+
+	tm := New().Client(cli).Url(server.URL).Fields([]string{"message"}).EventChannel(ch).ErrChannel(errCh).Build()
+
+	go tm.Stream()
+
+	tm.eventChannel <- backend.Event{Message: "some event"}
+
+	tm.Close()
+}
+
+func Test_StreamErr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("bad card"))
+	}))
+
+	cli := &http.Client{}
+	ch := make(chan backend.Event, 1)
+	errCh := make(chan error, 1)
+
+	tm := New().ErrChannel(errCh).Url(server.URL).Client(cli).EventChannel(ch).Build()
+
+	tm.eventChannel <- backend.Event{Message: "my event"}
+	tm.Close()
+	tm.Stream()
+
+	err := <-errCh
+	assert.Equal(t, "400 Bad Request - bad card", err.Error())
+}
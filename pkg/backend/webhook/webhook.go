@@ -0,0 +1,258 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"text/template"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/phil-inc/admiral/pkg/utils"
+)
+
+const (
+	// DefaultSignatureHeader carries the HMAC
+	// signature of the body when a secret is set.
+	DefaultSignatureHeader = "X-Admiral-Signature-256"
+
+	defaultMethod      = "POST"
+	defaultContentType = "application/json"
+)
+
+type Builder struct {
+	url             string
+	client          *http.Client
+	logChannel      chan backend.RawLog
+	eventChannel    chan backend.Event
+	errChannel      chan error
+	method          string
+	headers         map[string]string
+	body            *template.Template
+	contentType     string
+	secret          []byte
+	signatureHeader string
+}
+
+// New returns a builder for the webhook struct.
+func New() *Builder {
+	return &Builder{
+		headers: make(map[string]string),
+	}
+}
+
+// Url sets the webhook url.
+func (b *Builder) Url(url string) *Builder {
+	b.url = url
+	return b
+}
+
+// LogChannel sets the channel from where
+// the webhook will take logs.
+func (b *Builder) LogChannel(logChannel chan backend.RawLog) *Builder {
+	b.logChannel = logChannel
+	return b
+}
+
+// EventChannel sets the channel from where
+// the webhook will take events.
+func (b *Builder) EventChannel(eventChannel chan backend.Event) *Builder {
+	b.eventChannel = eventChannel
+	return b
+}
+
+// ErrChannel sets the channel where the
+// webhook will send its errors.
+func (b *Builder) ErrChannel(errChannel chan error) *Builder {
+	b.errChannel = errChannel
+	return b
+}
+
+// Client sets the HTTP client.
+func (b *Builder) Client(client *http.Client) *Builder {
+	b.client = client
+	return b
+}
+
+// Method sets the HTTP method, POST (default),
+// PUT or PATCH.
+func (b *Builder) Method(method string) *Builder {
+	b.method = method
+	return b
+}
+
+// Header adds a header sent with every request.
+func (b *Builder) Header(name string, value string) *Builder {
+	b.headers[name] = value
+	return b
+}
+
+// Body sets the template rendering the request body
+// from the event fields, or from the log's labels with
+// its log and timestamp. Without one, the event or log
+// is sent as JSON.
+func (b *Builder) Body(body *template.Template) *Builder {
+	b.body = body
+	return b
+}
+
+// ContentType sets the Content-Type of the
+// body, defaulting to application/json.
+func (b *Builder) ContentType(contentType string) *Builder {
+	b.contentType = contentType
+	return b
+}
+
+// Signature signs each body with HMAC-SHA256 using
+// the secret, sending it as "sha256=<hex>" in the
+// header, which defaults to DefaultSignatureHeader.
+func (b *Builder) Signature(header string, secret string) *Builder {
+	b.signatureHeader = header
+	b.secret = []byte(secret)
+	return b
+}
+
+// Build returns a configured webhook struct.
+func (b *Builder) Build() *webhook {
+	method := b.method
+	if method == "" {
+		method = defaultMethod
+	}
+
+	contentType := b.contentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+
+	signatureHeader := b.signatureHeader
+	if signatureHeader == "" {
+		signatureHeader = DefaultSignatureHeader
+	}
+
+	return &webhook{
+		url:             b.url,
+		client:          b.client,
+		logChannel:      b.logChannel,
+		eventChannel:    b.eventChannel,
+		errChannel:      b.errChannel,
+		method:          method,
+		headers:         b.headers,
+		body:            b.body,
+		contentType:     contentType,
+		secret:          b.secret,
+		signatureHeader: signatureHeader,
+	}
+}
+
+type webhook struct {
+	url             string
+	client          *http.Client
+	logChannel      chan backend.RawLog
+	eventChannel    chan backend.Event
+	errChannel      chan error
+	method          string
+	headers         map[string]string
+	body            *template.Template
+	contentType     string
+	secret          []byte
+	signatureHeader string
+}
+
+// Stream sends whatever is received on
+// logChannel and eventChannel to the webhook.
+func (w *webhook) Stream() {
+	if w.eventChannel != nil {
+		go w.streamEvents()
+	}
+
+	for raw := range w.logChannel {
+		w.send(raw)
+	}
+}
+
+func (w *webhook) streamEvents() {
+	for event := range w.eventChannel {
+		w.send(event)
+	}
+}
+
+func (w *webhook) send(data interface{}) {
+	req, err := w.request(data)
+	if err != nil {
+		w.errChannel <- err
+		return
+	}
+
+	_, err = utils.Do(req, w.client)
+	if err != nil {
+		w.errChannel <- err
+	}
+}
+
+func (w *webhook) request(data interface{}) (*http.Request, error) {
+	body, err := w.render(data)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(w.method, w.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", w.contentType)
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+
+	if len(w.secret) > 0 {
+		req.Header.Set(w.signatureHeader, "sha256="+sign(w.secret, body))
+	}
+
+	return req, nil
+}
+
+func (w *webhook) render(data interface{}) ([]byte, error) {
+	if w.body == nil {
+		return json.Marshal(data)
+	}
+
+	var fields map[string]string
+	switch data := data.(type) {
+	case backend.Event:
+		fields = data.Fields()
+	case backend.RawLog:
+		fields = map[string]string{}
+		for k, v := range data.Metadata {
+			fields[k] = v
+		}
+		fields["log"] = data.Log
+		fields["timestamp"] = data.Timestamp
+	}
+
+	var buf bytes.Buffer
+	if err := w.body.Execute(&buf, fields); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func sign(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Close closes the injected channels. Anything
+// already on the stack will get processed.
+func (w *webhook) Close() {
+	if w.logChannel != nil {
+		close(w.logChannel)
+	}
+
+	if w.eventChannel != nil {
+		close(w.eventChannel)
+	}
+}
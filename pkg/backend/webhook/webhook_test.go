@@ -0,0 +1,111 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"text/template"
+
+	"github.com/phil-inc/admiral/pkg/backend"
+	"github.com/phil-inc/admiral/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Build(t *testing.T) {
+	cli := &http.Client{}
+	ch := make(chan backend.Event)
+
+	w := New().Client(cli).EventChannel(ch).Url("webhook.com").Build()
+
+	assert.NotNil(t, w)
+	assert.Equal(t, "webhook.com", w.url)
+	assert.Equal(t, ch, w.eventChannel)
+	assert.Equal(t, "POST", w.method)
+	assert.Equal(t, "application/json", w.contentType)
+	assert.Equal(t, DefaultSignatureHeader, w.signatureHeader)
+}
+
+func Test_request(t *testing.T) {
+	body := template.Must(template.New("body").Funcs(utils.TemplateFuncs).Parse(`{"content": {{json .message}}}`))
+
+	w := New().Url("http://webhook.com").Method("PUT").Header("X-Token", "secret").Body(body).ContentType("application/vnd.discord+json").Signature("X-Signature", "key").Build()
+
+	req, err := w.request(backend.Event{Message: `some "quoted" event`})
+	assert.Nil(t, err)
+	assert.Equal(t, "PUT", req.Method)
+	assert.Equal(t, "secret", req.Header.Get("X-Token"))
+	assert.Equal(t, "application/vnd.discord+json", req.Header.Get("Content-Type"))
+
+	b, err := ioutil.ReadAll(req.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"content": "some \"quoted\" event"}`, string(b))
+
+	mac := hmac.New(sha256.New, []byte("key"))
+	mac.Write(b)
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), req.Header.Get("X-Signature"))
+
+	body = template.Must(template.New("body").Parse(`{{.pod}}: {{.log}}`))
+	w = New().Url("http://webhook.com").Body(body).Build()
+
+	req, err = w.request(backend.RawLog{Log: "some log", Metadata: map[string]string{"pod": "hello"}})
+	assert.Nil(t, err)
+
+	b, err = ioutil.ReadAll(req.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello: some log", string(b))
+}
+
+func Test_StreamLogs(t *testing.T) {
+	received := make(chan string, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Empty(t, r.Header.Get(DefaultSignatureHeader))
+
+		b, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		received <- string(b)
+	}))
+
+	ch := make(chan backend.RawLog, 1)
+	errCh := make(chan error, 1)
+
+	w := New().Client(&http.Client{}).Url(server.URL).LogChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- backend.RawLog{Log: "some log", Metadata: map[string]string{"pod": "hello"}}
+	w.Close()
+	w.Stream()
+
+	assert.Empty(t, errCh)
+	assert.JSONEq(t, `{"log":"some log","metadata":{"pod":"hello"},"timestamp":""}`, <-received)
+}
+
+func Test_StreamErr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	body := template.Must(template.New("body").Parse(`{{.log.Missing}}`))
+
+	ch := make(chan backend.RawLog, 2)
+	errCh := make(chan error, 2)
+
+	w := New().Client(&http.Client{}).Url(server.URL).LogChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- backend.RawLog{Log: "some log"}
+	w.Close()
+	w.Stream()
+	assert.Contains(t, (<-errCh).Error(), "404")
+
+	ch = make(chan backend.RawLog, 1)
+	w = New().Client(&http.Client{}).Url(server.URL).Body(body).LogChannel(ch).ErrChannel(errCh).Build()
+
+	ch <- backend.RawLog{Log: "some log"}
+	w.Close()
+	w.Stream()
+	assert.Contains(t, (<-errCh).Error(), "Missing")
+}
@@ -180,6 +180,8 @@ func (l *logstream) getTimestamp(msg string) (string, error) {
 	return fmt.Sprintf("%d", time.Now().UnixNano()), nil
 }
 
+// formatLogMetadata turns the label names into valid
+// Loki label names. Values are kept as they are.
 func formatLogMetadata(m map[string]string) map[string]string {
 	lm := make(map[string]string)
 	for k, v := range m {
@@ -187,11 +189,7 @@ func formatLogMetadata(m map[string]string) map[string]string {
 		parsedK = strings.ReplaceAll(parsedK, "\\", "_")
 		parsedK = strings.ReplaceAll(parsedK, "-", "_")
 		parsedK = strings.ReplaceAll(parsedK, "/", "_")
-		parsedV := strings.ReplaceAll(v, "\\", "_")
-		parsedV = strings.ReplaceAll(parsedV, "-", "_")
-		parsedV = strings.ReplaceAll(parsedV, ".", "_")
-		parsedV = strings.ReplaceAll(parsedV, "/", "_")
-		lm[parsedK] = parsedV
+		lm[parsedK] = v
 	}
 	return lm
 }
@@ -74,3 +74,17 @@ func Test_Logstream(t *testing.T) {
 
 	assert.Greater(t, len(results), 9)
 }
+
+func Test_formatLogMetadata(t *testing.T) {
+	actual := formatLogMetadata(map[string]string{
+		"app.kubernetes.io/name": "payments-api",
+		"pod-template-hash":      "7d4b9c",
+		"version":                "v1.2.3",
+	})
+
+	assert.Equal(t, map[string]string{
+		"app_kubernetes_io_name": "payments-api",
+		"pod_template_hash":      "7d4b9c",
+		"version":                "v1.2.3",
+	}, actual)
+}
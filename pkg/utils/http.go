@@ -4,14 +4,36 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"golang.org/x/exp/slices"
 )
 
 var SUCCESSFUL_STATUS_CODES = []int{200, 201, 202, 203, 204, 205, 206, 207, 208, 226}
 
+// HTTPError is returned when a request
+// gets an unsuccessful response status.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s - %s", e.Status, e.Body)
+}
+
 func Send(data interface{}, method string, url string, client *http.Client) error {
+	return SendWithHeaders(data, method, url, nil, client)
+}
+
+// SendWithHeaders is Send with extra request
+// headers, such as for authorization.
+func SendWithHeaders(data interface{}, method string, url string, headers map[string]string, client *http.Client) error {
 	body, err := json.Marshal(data)
 	if err != nil {
 		return err
@@ -23,15 +45,68 @@ func Send(data interface{}, method string, url string, client *http.Client) erro
 	}
 
 	req.Header.Add("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
 
+	_, err = Do(req, client)
+	return err
+}
+
+// SendWithRetry is SendWithHeaders, retrying up to retries
+// times while the server responds that it is rate limited.
+func SendWithRetry(data interface{}, method string, url string, headers map[string]string, client *http.Client, retries int) error {
+	for attempt := 0; ; attempt++ {
+		err := SendWithHeaders(data, method, url, headers, client)
+
+		wait, limited := RetryAfter(err)
+		if !limited || attempt == retries {
+			return err
+		}
+
+		time.Sleep(wait)
+	}
+}
+
+// Do sends the request and returns the response body,
+// or an *HTTPError if the response status is unsuccessful.
+func Do(req *http.Request, client *http.Client) ([]byte, error) {
 	res, err := client.Do(req)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
 	}
 
 	if !slices.Contains(SUCCESSFUL_STATUS_CODES, res.StatusCode) {
-		return fmt.Errorf("%s - %s", res.Status, res.Body)
+		return body, &HTTPError{
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			Header:     res.Header,
+			Body:       string(body),
+		}
+	}
+
+	return body, nil
+}
+
+// RetryAfter reports whether err is a 429 response and,
+// if so, how long its Retry-After header asks to wait.
+// It defaults to a second when the header is missing.
+func RetryAfter(err error) (time.Duration, bool) {
+	httpErr, ok := err.(*HTTPError)
+	if !ok || httpErr.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	seconds, err := strconv.Atoi(httpErr.Header.Get("Retry-After"))
+	if err != nil {
+		return time.Second, true
 	}
 
-	return nil
+	return time.Duration(seconds) * time.Second, true
 }
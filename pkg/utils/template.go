@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+	"text/template"
+)
+
+// TemplateFuncs are the functions available
+// to every template in the config.
+var TemplateFuncs = template.FuncMap{
+	"json":  toJSON,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// toJSON encodes v, so that it can be safely
+// embedded in a JSON template.
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -1,21 +1,22 @@
 package events
 
 import (
-	"fmt"
+	"time"
 
+	"github.com/phil-inc/admiral/pkg/backend"
 	"github.com/phil-inc/admiral/pkg/state"
 	v1 "k8s.io/api/core/v1"
 )
 
 type events struct {
 	state   *state.SharedMutable
-	channel chan string
+	channel chan backend.Event
 	filter  []string
 }
 
 type builder struct {
 	state   *state.SharedMutable
-	channel chan string
+	channel chan backend.Event
 	filter  []string
 }
 
@@ -30,7 +31,7 @@ func (b *builder) State(state *state.SharedMutable) *builder {
 }
 
 // Channel sets a string channel that should forward to the backend.
-func (b *builder) Channel(channel chan string) *builder {
+func (b *builder) Channel(channel chan backend.Event) *builder {
 	b.channel = channel
 	return b
 }
@@ -59,7 +60,7 @@ func (e *events) Add(obj interface{}) {
 	// check if the event was created before admiral started.
 	if e.state.InitTimestamp().Before(event.ObjectMeta.CreationTimestamp.Time) {
 		if e.inFilter(event.Reason) {
-			e.channel <- e.formatMessage(event)
+			e.channel <- e.toEvent(event)
 		}
 	}
 }
@@ -73,15 +74,32 @@ func (e *events) inFilter(s string) bool {
 	return false
 }
 
-func (e *events) formatMessage(event *v1.Event) string {
-	return fmt.Sprintf(`
-cluster:   %s
-namespace: %s
-object:    %s
-reason:    %s
-message:   %s
-timestamp: %s`,
-		e.state.Cluster(), event.Namespace, event.InvolvedObject.Name, event.Reason, event.Message, event.CreationTimestamp.Time)
+func (e *events) toEvent(event *v1.Event) backend.Event {
+	return backend.Event{
+		Cluster:   e.state.Cluster(),
+		Namespace: event.Namespace,
+		Kind:      event.InvolvedObject.Kind,
+		Name:      event.InvolvedObject.Name,
+		Reason:    event.Reason,
+		Type:      event.Type,
+		Message:   event.Message,
+		Labels:    event.Labels,
+		Timestamp: eventTimestamp(event),
+	}
+}
+
+// eventTimestamp returns when the event last happened,
+// falling back to when the event object was created.
+func eventTimestamp(event *v1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
+	}
+
+	return event.CreationTimestamp.Time
 }
 
 func (e *events) Update(new interface{}, old interface{}) {}
@@ -2,10 +2,13 @@ package events
 
 import (
 	"testing"
+	"time"
 
+	"github.com/phil-inc/admiral/pkg/backend"
 	"github.com/phil-inc/admiral/pkg/state"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var mocked_event *v1.Event = &v1.Event{
@@ -19,17 +22,17 @@ var mocked_event *v1.Event = &v1.Event{
 
 func Test_AddHandler(t *testing.T) {
 	shared_state := state.New("cluster-world")
-	msgCh := make(chan string)
+	msgCh := make(chan backend.Event)
 	matchingFilter := []string{"hello-world"}
 	failingFilter := []string{"goodnight"}
 	mocked_event.ObjectMeta.CreationTimestamp.Time = shared_state.InitTimestamp().Add(10)
 
 	event_watcher := New().State(shared_state).Channel(msgCh).Filter(matchingFilter).Build()
 
-	formattedMsg := event_watcher.formatMessage(mocked_event)
+	expected := event_watcher.toEvent(mocked_event)
 	go func() {
 		for msg := range msgCh {
-			assert.Equal(t, formattedMsg, msg)
+			assert.Equal(t, expected, msg)
 		}
 	}()
 	defer close(msgCh)
@@ -40,3 +43,15 @@ func Test_AddHandler(t *testing.T) {
 
 	failing_watcher.Add(mocked_event)
 }
+
+func Test_eventTimestamp(t *testing.T) {
+	created := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	last := created.Add(time.Minute)
+
+	event := &v1.Event{}
+	event.CreationTimestamp = metav1.NewTime(created)
+	assert.Equal(t, created, eventTimestamp(event))
+
+	event.LastTimestamp = metav1.NewTime(last)
+	assert.Equal(t, last, eventTimestamp(event))
+}
@@ -124,18 +124,25 @@ func (l *logs) addContainersToState(pod *v1.Pod) {
 		l.state.Set(name, state.RUNNING)
 
 		if l.state.GetKubeClient() != nil {
-			metadata := make(map[string]string)
-			if pod.Labels != nil {
-				metadata = pod.Labels
-			}
-			metadata["pod"] = pod.Name
-			metadata["namespace"] = pod.Namespace
-
-			go logstream.New().State(l.state).Pod(pod).Container(container).Metadata(metadata).RawLogChannel(l.rawLogChannel).Build().Stream()
+			go logstream.New().State(l.state).Pod(pod).Container(container).Metadata(podMetadata(pod, container)).RawLogChannel(l.rawLogChannel).Build().Stream()
 		}
 	}
 }
 
+// podMetadata labels the logs of the container with a
+// copy of the pod labels, its pod, namespace and name.
+func podMetadata(pod *v1.Pod, container v1.Container) map[string]string {
+	metadata := make(map[string]string, len(pod.Labels)+3)
+	for k, v := range pod.Labels {
+		metadata[k] = v
+	}
+	metadata["pod"] = pod.Name
+	metadata["namespace"] = pod.Namespace
+	metadata["container"] = container.Name
+
+	return metadata
+}
+
 func (l *logs) finishContainersInState(pod *v1.Pod) {
 	ignoreList := pod.Annotations[l.ignoreContainerAnnotation]
 
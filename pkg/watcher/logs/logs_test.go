@@ -79,3 +79,21 @@ func Test_Handlers(t *testing.T) {
 	time.Sleep(1 * time.Millisecond)
 	assert.Equal(t, "", st.Get(stateKey))
 }
+
+func Test_podMetadata(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "api-7d4b9c-x2k8p",
+			Namespace: "payments",
+			Labels:    map[string]string{"app": "api"},
+		},
+	}
+
+	assert.Equal(t, map[string]string{
+		"app":       "api",
+		"pod":       "api-7d4b9c-x2k8p",
+		"namespace": "payments",
+		"container": "istio-proxy",
+	}, podMetadata(pod, v1.Container{Name: "istio-proxy"}))
+	assert.Equal(t, map[string]string{"app": "api"}, pod.Labels)
+}